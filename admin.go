@@ -2,28 +2,232 @@ package main
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/gocolly/colly"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
 func init() {
 	router.addCommand(
 		command{
-			name:        "cleardb",
-			description: "Clears all items in the database for a specific collection.",
-			args:        []string{"<colName>"},
-			handler:     clearDb,
-			aliases:     []string{"dbclear"},
+			name:        "Guilds",
+			description: "Lists the servers the bot is in along with their request counts.",
+			handler:     guildsCommand,
+			category:    "Admin",
+			examples:    []string{"guilds"},
+			aliases:     []string{"servers"},
+			ownerOnly:   true,
 		},
 	)
+	router.addCommand(
+		command{
+			name:        "FlushCache",
+			description: "Clears the affiliate URL cache, the cached part embeds or both.",
+			args:        []string{"<target:affiliates|views|all>"},
+			handler:     flushCacheCommand,
+			category:    "Admin",
+			examples:    []string{"flushcache affiliates", "flushcache all"},
+			aliases:     []string{"clearcache"},
+			ownerOnly:   true,
+		},
+	)
+	router.addCommand(
+		command{
+			name:        "Status",
+			description: "Shows the status of the scraper, proxies and gateway.",
+			handler:     statusCommand,
+			category:    "Admin",
+			examples:    []string{"status"},
+			ownerOnly:   true,
+		},
+	)
+	router.addCommand(
+		command{
+			name:        "Announce",
+			description: "Sends an announcement to every server that has opted in to announcements.",
+			args:        []string{"<message>"},
+			handler:     announceCommand,
+			category:    "Admin",
+			examples:    []string{"announce PartsBot will be down for maintenance tonight."},
+			aliases:     []string{"broadcast"},
+			ownerOnly:   true,
+		},
+	)
+}
+
+func isOwner(userID string) bool {
+	for _, owner := range conf().Bot.Owners {
+		if owner == userID {
+			return true
+		}
+	}
+	return false
 }
 
-func clearDb(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-	if m.Author.ID != "405798011172814868" {
-		s.ChannelMessageSend(m.ChannelID, "go away")
+func guildsCommand(s *discordgo.Session, m *discordgo.MessageCreate, _ commandArgs) {
+	requests := map[string]int{}
+
+	cur, err := db.Collection("guilds").Find(ctx, bson.M{})
+	if err != nil {
+		sendError(s, "Failed to fetch guilds.", m.ChannelID)
+		return
+	}
+	var dbGuilds []guild
+	if err := cur.All(ctx, &dbGuilds); err != nil {
+		log.WithError(err).Error("Failed to decode guilds")
+		sendError(s, "Failed to fetch guilds.", m.ChannelID)
 		return
 	}
-	res, _ := db.Collection(args[0]).DeleteMany(ctx, bson.M{})
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Deleted %v document(s)", res.DeletedCount))
+	for _, g := range dbGuilds {
+		requests[g.ID] = g.Requests
+	}
+
+	s.State.RLock()
+	guilds := append([]*discordgo.Guild{}, s.State.Guilds...)
+	s.State.RUnlock()
+	sort.Slice(guilds, func(i, j int) bool {
+		return requests[guilds[i].ID] > requests[guilds[j].ID]
+	})
+
+	lines := []string{}
+	for _, g := range guilds {
+		line := fmt.Sprintf("**%s** (%s): %v request(s)", g.Name, g.ID, requests[g.ID])
+		if len(strings.Join(append(lines, line), "\n")) > 4000 {
+			lines = append(lines, fmt.Sprintf("*+%v more...*", len(guilds)-len(lines)))
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("In %v server(s)", len(guilds)),
+			Description: strings.Join(lines, "\n"),
+			Color:       accent,
+		},
+		Reference: m.Reference(),
+	})
+}
+
+func flushCacheCommand(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+	target := args.String("target")
+	flushed := []string{}
+
+	if target == "affiliates" || target == "all" {
+		res, err := db.Collection("urls").DeleteMany(ctx, bson.M{})
+		if err != nil {
+			sendError(s, "Failed to flush the affiliate URL cache.", m.ChannelID)
+			return
+		}
+		flushed = append(flushed, fmt.Sprintf("%v affiliate URL(s)", res.DeletedCount))
+	}
+	if target == "views" || target == "all" {
+		partViewsMutex.Lock()
+		count := len(partViews)
+		partViews = map[string]*partView{}
+		partViewsMutex.Unlock()
+		flushed = append(flushed, fmt.Sprintf("%v part embed(s)", count))
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Description: fmt.Sprintf("Flushed %s.", strings.Join(flushed, " and ")),
+			Color:       accent,
+		},
+		Reference: m.Reference(),
+	})
+}
+
+// Checks whether PCPartPicker can be reached through the scraper, returning how long the request took.
+func checkScraper() (time.Duration, error) {
+	col := newScraper().Collector
+
+	var reqErr error
+	col.OnError(func(_ *colly.Response, err error) {
+		reqErr = err
+	})
+
+	start := time.Now()
+	if err := col.Visit("https://pcpartpicker.com/"); err != nil {
+		return 0, err
+	}
+	col.Wait()
+
+	return time.Since(start), reqErr
+}
+
+func statusCommand(s *discordgo.Session, m *discordgo.MessageCreate, _ commandArgs) {
+	scraperStatus := ""
+	if took, err := checkScraper(); err != nil {
+		scraperStatus = fmt.Sprintf("Failing: %s", err.Error())
+	} else {
+		scraperStatus = fmt.Sprintf("OK (%v)", took.Round(time.Millisecond))
+	}
+
+	partViewsMutex.Lock()
+	views := len(partViews)
+	partViewsMutex.Unlock()
+
+	c := conf()
+	tracking := "Disabled"
+	if c.Tracking.Enabled {
+		tracking = "Enabled"
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title: "Bot status",
+			Color: accent,
+			Fields: []*discordgo.MessageEmbedField{
+				{Name: "Scraper", Value: scraperStatus},
+				{Name: "Proxies", Value: fmt.Sprintf("%v", len(c.PCPartPicker.Proxies)), Inline: true},
+				{Name: "Regions", Value: fmt.Sprintf("%v", len(regions)), Inline: true},
+				{Name: "Affiliates", Value: fmt.Sprintf("%v", len(c.PCPartPicker.Affiliates)), Inline: true},
+				{Name: "Click tracking", Value: tracking, Inline: true},
+				{Name: "Cached part embeds", Value: fmt.Sprintf("%v", views), Inline: true},
+				{Name: "Gateway latency", Value: s.HeartbeatLatency().Round(time.Millisecond).String(), Inline: true},
+			},
+		},
+		Reference: m.Reference(),
+	})
+}
+
+func announceCommand(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+	cur, err := db.Collection("guilds").Find(ctx, bson.M{
+		"announcement_channel": bson.M{"$nin": []interface{}{"", nil}},
+	})
+	if err != nil {
+		sendError(s, "Failed to fetch guilds.", m.ChannelID)
+		return
+	}
+	var guilds []guild
+	if err := cur.All(ctx, &guilds); err != nil {
+		log.WithError(err).Error("Failed to decode guilds")
+		sendError(s, "Failed to fetch guilds.", m.ChannelID)
+		return
+	}
+
+	sent := 0
+	for _, g := range guilds {
+		_, err := s.ChannelMessageSendEmbed(g.AnnouncementChannel, &discordgo.MessageEmbed{
+			Title:       "PartsBot announcement",
+			Description: args.String("message"),
+			Color:       accent,
+		})
+		if err == nil {
+			sent++
+		}
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Description: fmt.Sprintf("Sent announcement to %v of %v server(s).", sent, len(guilds)),
+			Color:       accent,
+		},
+		Reference: m.Reference(),
+	})
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dlclark/regexp2"
+	"github.com/gocolly/colly"
+	"github.com/quakecodes/gopartpicker"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/sync/singleflight"
+)
+
+// Where a vendor link is being output, used to attribute clicks.
+type linkSource struct {
+	GuildID string
+	PartURL string
+	// correlation ID of the request the link is output for
+	RequestID string
+}
+
+func (src linkSource) logger() *logrus.Entry {
+	return log.WithFields(logrus.Fields{
+		"request_id": src.RequestID,
+		"guild":      src.GuildID,
+		"part":       src.PartURL,
+	})
+}
+
+// A vendor link as it is output by the bot.
+type vendorLink struct {
+	URL string
+}
+
+var (
+	affiliateIDRegexp = regexp2.MustCompile(`(?<=\/mr\/)[a-zA-Z]*\/[a-zA-Z0-9]{4,8}`, 0)
+	affiliateLookups  singleflight.Group
+)
+
+func extractAffiliateID(URL string) string {
+	match, _ := affiliateIDRegexp.FindStringMatch(URL)
+	if match == nil {
+		return ""
+	}
+	return match.String()
+}
+
+// Finds the configured affiliate for a vendor, using either the vendor's name or the vendor in its PCPartPicker link.
+func matchAffiliate(vendor gopartpicker.Vendor) *affiliate {
+	names := []string{
+		strings.ToLower(vendor.Name),
+		strings.ToLower(gopartpicker.ExtractVendorName(vendor.URL)),
+	}
+	affiliates := conf().PCPartPicker.Affiliates
+	for i, aff := range affiliates {
+		for _, name := range names {
+			if name != "" && strings.Contains(name, strings.ToLower(aff.Name)) {
+				return &affiliates[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Resolves the link that should be output for a vendor. Every vendor link the bot sends should go through this so
+// that affiliate codes and click tracking are applied consistently.
+func resolveVendorLink(vendor gopartpicker.Vendor, src linkSource) vendorLink {
+	aff := matchAffiliate(vendor)
+	if aff == nil || vendor.URL == "" {
+		return vendorLink{URL: vendor.URL}
+	}
+
+	URL, ok := getAffiliate(vendor, *aff, src.logger())
+	if !ok {
+		return vendorLink{URL: vendor.URL}
+	}
+
+	// recorded whether or not tracking is on, which also stores the affiliate with each tracked link
+	affiliateLinks.WithLabelValues(aff.Name).Inc()
+	src.logger().WithFields(logrus.Fields{
+		"affiliate": aff.Name,
+		"vendor":    vendor.Name,
+	}).Debug("Rewrote vendor link")
+
+	return vendorLink{
+		URL: trackedURL(URL, aff.Name, vendor.Name, src),
+	}
+}
+
+// Resolves links for many vendors in parallel, keeping their order. Each vendor is output from the source at the
+// same index.
+func resolveVendorLinks(vendors []gopartpicker.Vendor, sources []linkSource) []vendorLink {
+	links := make([]vendorLink, len(vendors))
+
+	var wg sync.WaitGroup
+	for i, vendor := range vendors {
+		wg.Add(1)
+		go func(i int, vendor gopartpicker.Vendor) {
+			defer wg.Done()
+			// fall back to the vendor's own link if resolving it panics
+			defer recoverWorker(sources[i].logger(), "vendor link", func() {
+				links[i] = vendorLink{URL: vendor.URL}
+			})
+			links[i] = resolveVendorLink(vendor, sources[i])
+		}(i, vendor)
+	}
+	wg.Wait()
+
+	return links
+}
+
+// Gets the affiliate URL for a vendor. Concurrent lookups for the same /mr/ ID, affiliate and code share a single
+// request.
+func getAffiliate(vendor gopartpicker.Vendor, aff affiliate, logger *logrus.Entry) (string, bool) {
+	urlId := extractAffiliateID(vendor.URL)
+	if urlId == "" {
+		return "", false
+	}
+
+	// the same key as the cache, otherwise lookups for different affiliates would get each other's URLs
+	lookupKey := strings.Join([]string{urlId, aff.Name, aff.Code}, "|")
+	url, err, _ := affiliateLookups.Do(lookupKey, func() (interface{}, error) {
+		return lookupAffiliate(vendor, aff, urlId, logger)
+	})
+	if err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"vendor":    vendor.Name,
+			"affiliate": aff.Name,
+			"url":       vendor.URL,
+		}).Warn("Failed to convert affiliate link")
+		return "", false
+	}
+
+	return url.(string), true
+}
+
+func lookupAffiliate(vendor gopartpicker.Vendor, aff affiliate, urlId string, logger *logrus.Entry) (string, error) {
+	// cached links are keyed by the affiliate's code too, so changing a code invalidates them
+	key := bson.M{
+		"id":        urlId,
+		"affiliate": aff.Name,
+		"code":      aff.Code,
+	}
+
+	var doc bson.M
+	res := db.Collection("urls").FindOne(ctx, key)
+	if err := res.Decode(&doc); err == nil {
+		if url, ok := doc["url"].(string); ok {
+			observeCacheLookup("affiliate_urls", true)
+			return url, nil
+		}
+	}
+	observeCacheLookup("affiliate_urls", false)
+
+	redirectURL, err := resolveRedirect(vendor.URL, logger)
+	if err != nil {
+		return "", err
+	}
+
+	baseURL, err := canonicalAffiliateURL(redirectURL, aff)
+	if err != nil {
+		return "", err
+	}
+	url := fmt.Sprintf("%s?%s", baseURL, aff.Code)
+
+	db.Collection("urls").InsertOne(ctx, bson.M{
+		"id":        urlId,
+		"affiliate": aff.Name,
+		"code":      aff.Code,
+		"url":       url,
+		"vendor":    vendor.Name,
+		"created":   time.Now(),
+	})
+
+	return url, nil
+}
+
+// Extracts the retailer's product URL from a redirect using the affiliate's regexes. If the affiliate has an ID
+// regex, anything after the product ID is dropped so the same product always maps to the same URL.
+func canonicalAffiliateURL(redirectURL string, aff affiliate) (string, error) {
+	if aff.fullRegexp == nil {
+		return "", fmt.Errorf("affiliate %s has no compiled full_regexp", aff.Name)
+	}
+
+	match, _ := aff.fullRegexp.FindStringMatch(redirectURL)
+	if match == nil {
+		return "", fmt.Errorf("affiliate %s didn't match redirect %s", aff.Name, redirectURL)
+	}
+	baseURL := match.String()
+
+	if aff.extractIDRegexp == nil {
+		return baseURL, nil
+	}
+
+	idMatch, _ := aff.extractIDRegexp.FindStringMatch(baseURL)
+	if idMatch == nil {
+		return "", fmt.Errorf("affiliate %s couldn't extract a product ID from %s", aff.Name, baseURL)
+	}
+
+	// regexp2 indexes by rune rather than byte
+	return string([]rune(baseURL)[:idMatch.Index+idMatch.Length]), nil
+}
+
+// Follows a vendor link to the retailer's page. Each call uses its own collector so that concurrent resolutions
+// don't share callbacks or results.
+func resolveRedirect(URL string, logger *logrus.Entry) (string, error) {
+	col := newScraper().Collector
+
+	var redirectURL string
+	var reqErr error
+
+	col.OnResponse(func(r *colly.Response) {
+		redirectURL = r.Request.URL.String()
+	})
+	col.OnError(func(_ *colly.Response, err error) {
+		reqErr = err
+	})
+
+	start := time.Now()
+	if err := col.Visit(URL); err != nil {
+		observeScrape(logger, "affiliate", start, err)
+		return "", err
+	}
+	col.Wait()
+	observeScrape(logger, "affiliate", start, reqErr)
+
+	if reqErr != nil {
+		return "", reqErr
+	}
+	return redirectURL, nil
+}
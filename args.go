@@ -0,0 +1,377 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A declared argument of a command. Arguments are declared as strings such as "<partName>", "[days:int]",
+// "<state:on|off>" or "[--region:region]", where angle brackets mark required arguments, square brackets optional
+// ones, a leading -- a named flag and the part after a colon the argument's type or allowed values. Flags without a
+// type don't take a value.
+type argSpec struct {
+	name     string
+	kind     string
+	options  []string
+	optional bool
+	flag     bool
+}
+
+// A token of a command's input, quoted tokens are never treated as flags. start and end are the token's byte offsets
+// in the input, including any quotes.
+type argToken struct {
+	text   string
+	quoted bool
+	start  int
+	end    int
+}
+
+// Parsed arguments of a command, keyed by their declared names.
+type commandArgs struct {
+	values map[string]interface{}
+}
+
+const (
+	argString  = "string"
+	argInt     = "int"
+	argPrice   = "price"
+	argRegion  = "region"
+	argURL     = "url"
+	argUser    = "user"
+	argChannel = "channel"
+	argBool    = "bool"
+)
+
+var (
+	userMentionRegexp    = regexp.MustCompile(`^<@!?(\d{15,21})>$`)
+	channelMentionRegexp = regexp.MustCompile(`^<#(\d{15,21})>$`)
+	snowflakeRegexp      = regexp.MustCompile(`^\d{15,21}$`)
+)
+
+func parseArgSpec(decl string) argSpec {
+	spec := argSpec{
+		optional: strings.HasPrefix(decl, "["),
+		kind:     argString,
+	}
+	name := strings.Trim(decl, "<>[]")
+
+	if strings.HasPrefix(name, "--") {
+		spec.flag = true
+		spec.optional = true
+		spec.kind = argBool
+		name = strings.TrimPrefix(name, "--")
+	}
+	if i := strings.Index(name, ":"); i != -1 {
+		spec.kind = name[i+1:]
+		name = name[:i]
+	}
+	if strings.Contains(spec.kind, "|") {
+		spec.options = strings.Split(spec.kind, "|")
+		spec.kind = argString
+	} else if strings.Contains(name, "|") {
+		spec.options = strings.Split(name, "|")
+	}
+	spec.name = name
+
+	return spec
+}
+
+// Splits a command's input on whitespace. Single or double quotes at the start of a word group words into one token,
+// so apostrophes within words are left alone, and a backslash escapes the character after it.
+func splitArgs(input string) ([]argToken, error) {
+	tokens := []argToken{}
+	var current strings.Builder
+	inToken := false
+	start := 0
+	quoted := false
+	var quote rune
+	escaped := false
+
+	for i, char := range input {
+		if !inToken && !unicode.IsSpace(char) {
+			start = i
+		}
+		switch {
+		case escaped:
+			current.WriteRune(char)
+			escaped = false
+		case char == '\\':
+			escaped = true
+			inToken = true
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			} else {
+				current.WriteRune(char)
+			}
+		case (char == '"' || char == '\'') && !inToken:
+			quote = char
+			quoted = true
+			inToken = true
+		case unicode.IsSpace(char):
+			if inToken {
+				tokens = append(tokens, argToken{text: current.String(), quoted: quoted, start: start, end: i})
+				current.Reset()
+				inToken = false
+				quoted = false
+			}
+		default:
+			current.WriteRune(char)
+			inToken = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("missing a closing %c quote", quote)
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	if inToken {
+		tokens = append(tokens, argToken{text: current.String(), quoted: quoted, start: start, end: len(input)})
+	}
+
+	return tokens, nil
+}
+
+// Parses a command's input against its declared arguments. If there are more words than arguments, the last argument
+// gets the rest of the words with the spacing they were typed with, as long as it's a plain string. Flags are only parsed for commands that
+// declare them, so free text such as an announcement can contain words starting with --.
+func parseArgs(decls []string, input string) (commandArgs, error) {
+	args := commandArgs{values: map[string]interface{}{}}
+
+	tokens, err := splitArgs(input)
+	if err != nil {
+		return args, err
+	}
+
+	positional := []argSpec{}
+	flags := map[string]argSpec{}
+	for _, decl := range decls {
+		spec := parseArgSpec(decl)
+		if spec.flag {
+			flags[strings.ToLower(spec.name)] = spec
+		} else {
+			positional = append(positional, spec)
+		}
+	}
+
+	values := []argToken{}
+	// the index of each value in tokens, to tell whether flags were given between them
+	valueIndexes := []int{}
+	flagsDone := len(flags) == 0
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if flagsDone || token.quoted || !strings.HasPrefix(token.text, "--") {
+			values = append(values, token)
+			valueIndexes = append(valueIndexes, i)
+			continue
+		}
+		if token.text == "--" {
+			// everything after a lone -- is positional
+			flagsDone = true
+			continue
+		}
+
+		name := strings.TrimPrefix(token.text, "--")
+		value := ""
+		if j := strings.Index(name, "="); j != -1 {
+			name, value = name[:j], name[j+1:]
+		}
+		spec, ok := flags[strings.ToLower(name)]
+		if !ok {
+			return args, fmt.Errorf("unknown flag `--%s`", name)
+		}
+
+		if spec.kind == argBool {
+			args.values[spec.name] = true
+			continue
+		}
+		if !strings.Contains(token.text, "=") {
+			if i+1 >= len(tokens) {
+				return args, fmt.Errorf("`--%s` needs a value", spec.name)
+			}
+			i++
+			value = tokens[i].text
+		}
+		parsed, err := parseArgValue(spec, value)
+		if err != nil {
+			return args, err
+		}
+		args.values[spec.name] = parsed
+	}
+
+	if len(values) > len(positional) {
+		if len(positional) == 0 {
+			// commands without arguments ignore anything after them
+			return args, nil
+		}
+		last := positional[len(positional)-1]
+		if last.kind != argString || len(last.options) > 0 {
+			return args, fmt.Errorf("too many arguments, `%s` was unexpected", values[len(positional)].text)
+		}
+
+		first := len(positional) - 1
+		rest := values[first:]
+		// quotes and escapes work like they do anywhere else, but the spacing and line breaks between words that
+		// weren't split up by flags are kept as they were typed
+		var text strings.Builder
+		for j, token := range rest {
+			if j > 0 {
+				prev := rest[j-1]
+				if valueIndexes[first+j]-valueIndexes[first+j-1] == 1 {
+					text.WriteString(input[prev.end:token.start])
+				} else {
+					text.WriteString(" ")
+				}
+			}
+			text.WriteString(token.text)
+		}
+		values = append(values[:first], argToken{text: text.String()})
+	}
+
+	for i, spec := range positional {
+		if i >= len(values) {
+			if !spec.optional {
+				return args, fmt.Errorf("missing `%s`", spec.name)
+			}
+			continue
+		}
+		parsed, err := parseArgValue(spec, values[i].text)
+		if err != nil {
+			return args, err
+		}
+		args.values[spec.name] = parsed
+	}
+
+	return args, nil
+}
+
+// Checks a value against an argument's options and type, converting it into the type's Go value.
+func parseArgValue(spec argSpec, value string) (interface{}, error) {
+	if len(spec.options) > 0 {
+		lower := strings.ToLower(value)
+		for _, opt := range spec.options {
+			if lower == strings.ToLower(opt) {
+				return opt, nil
+			}
+		}
+		return nil, fmt.Errorf("`%s` must be one of %s", spec.name, strings.Join(spec.options, ", "))
+	}
+
+	switch spec.kind {
+	case argInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("`%s` must be a whole number", spec.name)
+		}
+		return n, nil
+	case argPrice:
+		// plain numbers are in whatever currency the command is working in
+		if amount, err := parseAmount(value); err == nil && strings.Trim(value, "0123456789.,") == "" {
+			return money{Amount: amount}, nil
+		}
+		price, err := parsePrice(value, "")
+		if errors.Is(err, errAmbiguousCurrency) {
+			// symbols shared between currencies, such as $, are taken to be in the command's currency too
+			if amount, err := parseAmount(trimAmbiguousSymbol(value)); err == nil {
+				return money{Amount: amount}, nil
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("`%s` must be a price such as 300 or £249.99", spec.name)
+		}
+		return price, nil
+	case argRegion:
+		code := strings.ToLower(value)
+		if !isRegion(code) {
+			return nil, fmt.Errorf("`%s` must be a region code such as us or uk, see the regions command", spec.name)
+		}
+		return code, nil
+	case argURL:
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("`%s` must be a link", spec.name)
+		}
+		return value, nil
+	case argUser:
+		if match := userMentionRegexp.FindStringSubmatch(value); match != nil {
+			return match[1], nil
+		}
+		if snowflakeRegexp.MatchString(value) {
+			return value, nil
+		}
+		return nil, fmt.Errorf("`%s` must be a user mention or ID", spec.name)
+	case argChannel:
+		if match := channelMentionRegexp.FindStringSubmatch(value); match != nil {
+			return match[1], nil
+		}
+		if snowflakeRegexp.MatchString(value) {
+			return value, nil
+		}
+		return nil, fmt.Errorf("`%s` must be a channel mention or ID", spec.name)
+	}
+
+	return value, nil
+}
+
+// Removes a currency symbol that's shared between currencies from either end of a price.
+func trimAmbiguousSymbol(value string) string {
+	value = strings.TrimSpace(value)
+	for symbol := range ambiguousSymbols {
+		if strings.HasPrefix(strings.ToLower(value), symbol) {
+			return strings.TrimSpace(value[len(symbol):])
+		}
+		if strings.HasSuffix(strings.ToLower(value), symbol) {
+			return strings.TrimSpace(value[:len(value)-len(symbol)])
+		}
+	}
+	return value
+}
+
+// Checks whether a region code is one PCPartPicker serves.
+func isRegion(code string) bool {
+	for _, reg := range regions {
+		if reg.code == code {
+			return true
+		}
+	}
+	// the region list can be empty if it failed to load
+	_, ok := regionCurrencies[code]
+	return len(regions) == 0 && ok
+}
+
+// Reports whether an argument was given.
+func (a commandArgs) Has(name string) bool {
+	_, ok := a.values[name]
+	return ok
+}
+
+// Returns a string, region, URL, user, channel or option argument, or an empty string if it wasn't given.
+func (a commandArgs) String(name string) string {
+	value, _ := a.values[name].(string)
+	return value
+}
+
+// Returns an int argument, or 0 if it wasn't given.
+func (a commandArgs) Int(name string) int {
+	value, _ := a.values[name].(int)
+	return value
+}
+
+// Returns a price argument. Prices given without a currency have an empty currency.
+func (a commandArgs) Money(name string) money {
+	value, _ := a.values[name].(money)
+	return value
+}
+
+// Returns whether a flag without a value was given.
+func (a commandArgs) Bool(name string) bool {
+	value, _ := a.values[name].(bool)
+	return value
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input  string
+		tokens []string
+		quoted []bool
+		err    string
+	}{
+		{"", []string{}, []bool{}, ""},
+		{"   ", []string{}, []bool{}, ""},
+		{"rtx 3080", []string{"rtx", "3080"}, []bool{false, false}, ""},
+		{"  rtx \t 3080\n", []string{"rtx", "3080"}, []bool{false, false}, ""},
+		{`"b550 tomahawk" uk`, []string{"b550 tomahawk", "uk"}, []bool{true, false}, ""},
+		{`'b550 tomahawk'`, []string{"b550 tomahawk"}, []bool{true}, ""},
+		{`"it's" here`, []string{"it's", "here"}, []bool{true, false}, ""},
+		{`Corsair's case`, []string{"Corsair's", "case"}, []bool{false, false}, ""},
+		{`say "hi"there`, []string{"say", "hithere"}, []bool{false, true}, ""},
+		{`""`, []string{""}, []bool{true}, ""},
+		{`a\ b`, []string{"a b"}, []bool{false}, ""},
+		{`\"quoted\"`, []string{`"quoted"`}, []bool{false}, ""},
+		{`"a \" b"`, []string{`a " b`}, []bool{true}, ""},
+		{`trailing\`, []string{`trailing\`}, []bool{false}, ""},
+		{`"--region" uk`, []string{"--region", "uk"}, []bool{true, false}, ""},
+		{`"unterminated`, nil, nil, "missing a closing \" quote"},
+		{`'unterminated`, nil, nil, "missing a closing ' quote"},
+	}
+
+	for _, test := range tests {
+		tokens, err := splitArgs(test.input)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("splitArgs(%q) error = %v, want %q", test.input, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitArgs(%q) error = %v", test.input, err)
+			continue
+		}
+
+		texts := []string{}
+		quoted := []bool{}
+		for _, token := range tokens {
+			texts = append(texts, token.text)
+			quoted = append(quoted, token.quoted)
+		}
+		if !reflect.DeepEqual(texts, test.tokens) || !reflect.DeepEqual(quoted, test.quoted) {
+			t.Errorf("splitArgs(%q) = %q %v, want %q %v", test.input, texts, quoted, test.tokens, test.quoted)
+		}
+	}
+}
+
+func TestSplitArgsOffsets(t *testing.T) {
+	input := ` one "two three"  four\ five`
+	tokens, err := splitArgs(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := []string{}
+	for _, token := range tokens {
+		raw = append(raw, input[token.start:token.end])
+	}
+	want := []string{"one", `"two three"`, `four\ five`}
+	if !reflect.DeepEqual(raw, want) {
+		t.Errorf("token offsets cover %q, want %q", raw, want)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	priceDecls := []string{"<partName>", "[--region:region]", "[--max:int]", "[--under:price]"}
+	announceDecls := []string{"<message>"}
+	purgeDecls := []string{"<target:urls|clicks|guilds>", "[days:int]"}
+	toggleDecls := []string{"<command>", "[--channel:channel]"}
+	flagDecls := []string{"[name]", "[--all]"}
+
+	tests := []struct {
+		decls  []string
+		input  string
+		values map[string]interface{}
+		err    string
+	}{
+		// free text
+		{priceDecls, "rtx 3080", map[string]interface{}{"partName": "rtx 3080"}, ""},
+		{priceDecls, `"b550 tomahawk"`, map[string]interface{}{"partName": "b550 tomahawk"}, ""},
+		{announceDecls, "Hello  there,\n\nnew **features**!", map[string]interface{}{"message": "Hello  there,\n\nnew **features**!"}, ""},
+		{announceDecls, `Use "quotes" and \backslashes`, map[string]interface{}{"message": `Use quotes and backslashes`}, ""},
+		{announceDecls, `Use \"quotes\" and \\backslashes`, map[string]interface{}{"message": `Use "quotes" and \backslashes`}, ""},
+		{priceDecls, `"rtx 3080" ti`, map[string]interface{}{"partName": "rtx 3080 ti"}, ""},
+		{priceDecls, "rtx\n\t3080", map[string]interface{}{"partName": "rtx\n\t3080"}, ""},
+		{announceDecls, "use --region to pick a store", map[string]interface{}{"message": "use --region to pick a store"}, ""},
+		{announceDecls, "--", map[string]interface{}{"message": "--"}, ""},
+
+		// flags
+		{priceDecls, "rtx 3080 --region uk --max 5", map[string]interface{}{"partName": "rtx 3080", "region": "uk", "max": 5}, ""},
+		{priceDecls, "--region=ca rtx 3080", map[string]interface{}{"partName": "rtx 3080", "region": "ca"}, ""},
+		{priceDecls, "rtx --max=3 3080", map[string]interface{}{"partName": "rtx 3080", "max": 3}, ""},
+		{priceDecls, "rtx 3080 --UNDER £700", map[string]interface{}{"partName": "rtx 3080", "under": money{Amount: 70000, Currency: "GBP"}}, ""},
+		{priceDecls, "rtx 3080 --under 700", map[string]interface{}{"partName": "rtx 3080", "under": money{Amount: 70000}}, ""},
+		{priceDecls, "rtx 3080 --under $700", map[string]interface{}{"partName": "rtx 3080", "under": money{Amount: 70000}}, ""},
+		{priceDecls, `"--region"`, map[string]interface{}{"partName": "--region"}, ""},
+		{priceDecls, `"--region" card`, map[string]interface{}{"partName": "--region card"}, ""},
+		{priceDecls, `amd --max 3 "ryzen 5"`, map[string]interface{}{"partName": "amd ryzen 5", "max": 3}, ""},
+		{priceDecls, `"amd"  --max 3 "ryzen 5"`, map[string]interface{}{"partName": "amd ryzen 5", "max": 3}, ""},
+		{priceDecls, "-- --max 5", map[string]interface{}{"partName": "--max 5"}, ""},
+		{priceDecls, "rtx --", map[string]interface{}{"partName": "rtx"}, ""},
+		{toggleDecls, "price --channel <#123456789012345678>", map[string]interface{}{"command": "price", "channel": "123456789012345678"}, ""},
+		{flagDecls, "--all", map[string]interface{}{"all": true}, ""},
+		{flagDecls, "bob --all", map[string]interface{}{"name": "bob", "all": true}, ""},
+		{priceDecls, "rtx --colour red", nil, "unknown flag `--colour`"},
+		{priceDecls, "rtx --max", nil, "`--max` needs a value"},
+		{priceDecls, "rtx --max five", nil, "`max` must be a whole number"},
+		{priceDecls, "rtx --region xx", nil, "`region` must be a region code such as us or uk, see the regions command"},
+		{flagDecls, "--all=yes", map[string]interface{}{"all": true}, ""},
+
+		// missing and extra arguments
+		{priceDecls, "", nil, "missing `partName`"},
+		{priceDecls, "--region uk", nil, "missing `partName`"},
+		{purgeDecls, "urls", map[string]interface{}{"target": "urls"}, ""},
+		{purgeDecls, "URLS 30", map[string]interface{}{"target": "urls", "days": 30}, ""},
+		{purgeDecls, "urls 30 40", nil, "too many arguments, `40` was unexpected"},
+		{purgeDecls, "links", nil, "`target` must be one of urls, clicks, guilds"},
+		{purgeDecls, "urls soon", nil, "`days` must be a whole number"},
+		{nil, "ignored words", map[string]interface{}{}, ""},
+		{announceDecls, `"unterminated`, nil, "missing a closing \" quote"},
+	}
+
+	for _, test := range tests {
+		args, err := parseArgs(test.decls, test.input)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("parseArgs(%q, %q) error = %v, want %q", strings.Join(test.decls, " "), test.input, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseArgs(%q, %q) error = %v", strings.Join(test.decls, " "), test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(args.values, test.values) {
+			t.Errorf("parseArgs(%q, %q) = %v, want %v", strings.Join(test.decls, " "), test.input, args.values, test.values)
+		}
+	}
+}
@@ -2,18 +2,37 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
 )
 
 type command struct {
 	name        string
 	description string
-	handler     func(*discordgo.Session, *discordgo.MessageCreate, []string)
-	args        []string
-	aliases     []string
+	handler     func(*discordgo.Session, *discordgo.MessageCreate, commandArgs)
+	// declared arguments, see argSpec for the syntax
+	args    []string
+	aliases []string
+	// hidden from everyone but the bot's owners
+	ownerOnly bool
+	// Discord permissions the user needs in the channel, e.g. discordgo.PermissionManageServer
+	permissions int64
+	// commands run by naming them after this one, e.g. "settings price on". A command with subcommands may leave its
+	// handler nil, in which case its subcommands are listed when it's run on its own.
+	subcommands []command
+	// the section help lists the command under, e.g. "Parts"
+	category string
+	// ways to run the command without the prefix, e.g. "price rtx 3080"
+	examples []string
+	// only usable in servers, which covers its subcommands too
+	guildOnly bool
+	// the full name the command is run with, set by the router
+	path string
 }
 
 type commandRouter struct {
@@ -40,9 +59,81 @@ func (r *commandRouter) addCommand(
 		r.aliases[strings.ToLower(a)] = lowerName
 	}
 
+	setCommandPaths(&comm, "")
 	r.commands[lowerName] = comm
 }
 
+func setCommandPaths(comm *command, parent string) {
+	comm.path = strings.TrimSpace(parent + " " + strings.ToLower(comm.name))
+	for i := range comm.subcommands {
+		setCommandPaths(&comm.subcommands[i], comm.path)
+	}
+}
+
+// Finds a subcommand by its name or one of its aliases.
+func (c command) getSubcommand(name string) *command {
+	name = strings.ToLower(name)
+	for i, sub := range c.subcommands {
+		if strings.ToLower(sub.name) == name {
+			return &c.subcommands[i]
+		}
+		for _, alias := range sub.aliases {
+			if strings.ToLower(alias) == name {
+				return &c.subcommands[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Follows the subcommands named at the start of the input, returning the deepest one along with the rest of the
+// input.
+func (c *command) resolve(input string) (*command, string) {
+	comm := c
+	for {
+		name, rest := splitFirstWord(input)
+		sub := comm.getSubcommand(name)
+		if name == "" || sub == nil {
+			return comm, input
+		}
+		comm, input = sub, rest
+	}
+}
+
+// Finds a command from its full name, such as "settings price".
+func (r commandRouter) resolveCommand(fullName string) *command {
+	name, rest := splitFirstWord(strings.TrimSpace(fullName))
+	comm := r.getCommand(name)
+	if comm == nil {
+		return nil
+	}
+	comm, rest = comm.resolve(rest)
+	if strings.TrimSpace(rest) != "" {
+		return nil
+	}
+	return comm
+}
+
+func splitFirstWord(input string) (string, string) {
+	input = strings.TrimLeftFunc(input, unicode.IsSpace)
+	if i := strings.IndexFunc(input, unicode.IsSpace); i != -1 {
+		return input[:i], input[i+1:]
+	}
+	return input, ""
+}
+
+// Checks whether a user has a command's required permissions in the channel it was used in.
+func hasPermissions(s *discordgo.Session, m *discordgo.MessageCreate, comm *command) bool {
+	if comm.permissions == 0 {
+		return true
+	}
+	perms, err := s.State.UserChannelPermissions(m.Author.ID, m.ChannelID)
+	if err != nil {
+		return false
+	}
+	return perms&comm.permissions == comm.permissions || perms&discordgo.PermissionAdministrator != 0
+}
+
 func (r commandRouter) getCommand(name string) *command {
 	baseCommName, ok := r.aliases[strings.ToLower(name)]
 	if !ok {
@@ -76,58 +167,142 @@ func (r commandRouter) getSubhandler(eventType int, name string) func(s *discord
 }
 
 func processCommands(s *discordgo.Session, m *discordgo.MessageCreate) bool {
-	if !strings.HasPrefix(m.Content, conf.Bot.Prefix) && !strings.HasPrefix(m.Content, botPing) {
+	var content string
+	pinged := false
+	if strings.HasPrefix(m.Content, botPing) {
+		content = strings.TrimSpace(strings.TrimPrefix(m.Content, botPing))
+		pinged = true
+	} else if strings.HasPrefix(m.Content, conf().Bot.Prefix) {
+		content = strings.TrimPrefix(m.Content, conf().Bot.Prefix)
+		// commands follow the prefix directly, ". hello" is just chat
+		if content == "" || unicode.IsSpace([]rune(content)[0]) {
+			return false
+		}
+	} else {
 		return false
 	}
-
-	splitParts := strings.Split(strings.TrimPrefix(strings.TrimPrefix(m.Content, conf.Bot.Prefix), botPing), " ")
-
-	commName := splitParts[0]
-	args := splitParts[1:]
+	commName, input := splitFirstWord(content)
 
 	comm := router.getCommand(commName)
 
-	if comm == nil {
-		s.ChannelMessageSend(m.ChannelID, "couldn't find command")
+	if comm == nil || (comm.ownerOnly && !isOwner(m.Author.ID)) {
+		return handleUnknownCommand(s, m, commName, pinged)
+	}
+	if comm.guildOnly && m.GuildID == "" {
+		sendError(s, "This command can only be used in servers.", m.ChannelID)
 		return true
-	} else if len(args) < len(comm.args) && comm.args[len(comm.args)-1][0] != '[' {
-		s.ChannelMessageSend(m.ChannelID, "incorrect command usage")
+	}
+	comm, input = comm.resolve(input)
+	// subcommands can be owner-only on their own, which the check on the top-level command doesn't cover. They're
+	// ignored like other hidden commands.
+	if comm.ownerOnly && !isOwner(m.Author.ID) {
 		return true
-	} else if len(args) > len(comm.args) {
-		args = append(args[:len(comm.args)-1], strings.Join(args[len(comm.args)-1:], " "))
 	}
 
-	for i, arg := range comm.args {
-		if i+1 > len(args) {
-			break
-		}
-		if strings.Contains(arg, "|") {
-			options := strings.Split(strings.Trim(arg, "<>[]"), "|")
-			found := false
-			for _, opt := range options {
-				if strings.ToLower(args[i]) == opt {
-					found = true
-				}
-			}
-			if !found {
-				s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
-					Embed: &discordgo.MessageEmbed{
-						Title:       "Invalid argument!",
-						Description: fmt.Sprintf("The correct usage for that command is:\n`%s`", comm.Usage()),
-						Color:       accent,
-					},
-				})
-				return true
-			}
+	if m.GuildID != "" {
+		// failing to load the guild shouldn't take every command down with it, so this only blocks on a loaded guild
+		g, err := getGuildState(m.GuildID)
+		if err == nil && isCommandDisabled(g, m.ChannelID, comm.path) {
+			sendCommandDisabled(s, m, g)
+			return true
 		}
 	}
 
-	go comm.handler(s, m, args)
+	if !hasPermissions(s, m, comm) {
+		s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+			Embed: &discordgo.MessageEmbed{
+				Title: fmt.Sprintf("You need the %s permission to do that.", permissionNames(comm.permissions)),
+				Color: accent,
+			},
+			Reference: m.Reference(),
+		})
+		return true
+	}
+
+	if comm.handler == nil {
+		s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+			Embed: &discordgo.MessageEmbed{
+				Title:       "Missing subcommand!",
+				Description: fmt.Sprintf("`%s` needs a subcommand:\n%s", comm.path, subcommandList(*comm, m.Author.ID)),
+				Color:       accent,
+			},
+			Reference: m.Reference(),
+		})
+		return true
+	}
+
+	args, err := parseArgs(comm.args, input)
+	if err != nil {
+		s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+			Embed: &discordgo.MessageEmbed{
+				Title:       "Invalid argument!",
+				Description: fmt.Sprintf("%s.\nThe correct usage for that command is:\n`%s`", strings.ToUpper(err.Error()[:1])+err.Error()[1:], comm.Usage()),
+				Color:       accent,
+			},
+			Reference: m.Reference(),
+		})
+		return true
+	}
+
+	logger := requestLogger(m.Message).WithFields(logrus.Fields{
+		"command": comm.path,
+		"user":    m.Author.ID,
+	})
+	logger.WithField("args", args.values).Debug("Running command")
+
+	commandInvocations.WithLabelValues(comm.path).Inc()
+	inFlight.Add(1)
+	go func() {
+		defer inFlight.Done()
+		defer recoverHandler(s, logger, m.ChannelID, "command "+comm.path)
+		start := time.Now()
+		comm.handler(s, m, args)
+		took := time.Since(start)
+		commandDuration.WithLabelValues(comm.path).Observe(took.Seconds())
+		logger.WithField("duration_ms", took.Milliseconds()).Info("Command finished")
+	}()
 	return true
 }
 
 func (c command) Usage() string {
-	return conf.Bot.Prefix + strings.ToLower(c.name) + " " + strings.Join(c.args, " ")
+	usage := conf().Bot.Prefix + c.path
+	if len(c.subcommands) > 0 && c.handler == nil {
+		return usage + " <subcommand>"
+	} else if len(c.subcommands) > 0 {
+		usage += " [subcommand]"
+	}
+	return strings.TrimSpace(usage + " " + strings.Join(c.args, " "))
+}
+
+// Lists the usage and description of a command's subcommands, leaving out owner-only ones for everyone else.
+func subcommandList(c command, userID string) string {
+	lines := []string{}
+	for _, sub := range c.subcommands {
+		if sub.ownerOnly && !isOwner(userID) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("`%s`: %s", sub.Usage(), sub.description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+var permissionLabels = map[int64]string{
+	discordgo.PermissionManageServer:   "Manage Server",
+	discordgo.PermissionManageChannels: "Manage Channels",
+	discordgo.PermissionManageMessages: "Manage Messages",
+	discordgo.PermissionAdministrator:  "Administrator",
+}
+
+// Names a set of permissions for error messages.
+func permissionNames(perms int64) string {
+	names := []string{}
+	for perm, label := range permissionLabels {
+		if perms&perm != 0 {
+			names = append(names, label)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, " and ")
 }
 
 func sendError(s *discordgo.Session, message string, channelID string) {
@@ -135,5 +310,5 @@ func sendError(s *discordgo.Session, message string, channelID string) {
 		Title: message,
 		Color: accent,
 	})
-	log.Println("Error: " + message)
+	log.WithField("channel", channelID).Warn(message)
 }
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dlclark/regexp2"
+	"github.com/quakecodes/gopartpicker"
+	"github.com/sirupsen/logrus"
+)
+
+type regionOffer struct {
+	region string
+	vendor gopartpicker.Vendor
+	price  money
+	// the price in the currency the comparison is shown in
+	converted float64
+	hasRate   bool
+	err       error
+}
+
+var (
+	productPathRegexp     = regexp2.MustCompile(`\/product\/[a-zA-Z0-9]{4,8}\/`, 0)
+	defaultCompareRegions = []string{"us", "uk", "ca", "au"}
+)
+
+func init() {
+	router.addCommand(
+		command{
+			name:        "PriceCompare",
+			description: "Compares the cheapest in-stock price of a part across regions. --max limits the number of search results.",
+			args:        []string{"<partName>", "[--max:int]"},
+			handler:     priceCompareCommand,
+			category:    "Parts",
+			examples:    []string{"pricecompare rtx 3080", "pricecompare \"ryzen 5 5600x\" --max 5"},
+			aliases:     []string{"compare", "comparepart"},
+		},
+	)
+}
+
+// Builds the URL of a product in a specific region.
+func regionalProductURL(URL string, region string) string {
+	match, _ := productPathRegexp.FindStringMatch(URL)
+	if match == nil {
+		return ""
+	}
+	if region == "us" {
+		return "https://pcpartpicker.com" + match.String()
+	}
+	return fmt.Sprintf("https://%s.pcpartpicker.com%s", region, match.String())
+}
+
+func compareRegions() []string {
+	if len(conf().PCPartPicker.CompareRegions) > 0 {
+		return conf().PCPartPicker.CompareRegions
+	}
+	return defaultCompareRegions
+}
+
+func baseCurrency() string {
+	if conf().PCPartPicker.BaseCurrency != "" {
+		return strings.ToUpper(conf().PCPartPicker.BaseCurrency)
+	}
+	return "USD"
+}
+
+// Returns the configured rate of a currency, in units per one unit of the base currency.
+func exchangeRate(currency string) (float64, bool) {
+	if currency == baseCurrency() {
+		return 1, true
+	}
+	rate, ok := conf().PCPartPicker.Rates[currency]
+	if !ok || rate <= 0 {
+		return 0, false
+	}
+	return rate, true
+}
+
+// Converts an amount of money into another currency through the base currency using the configured rates.
+func convertPrice(price money, currency string) (float64, bool) {
+	if price.Currency == currency {
+		return price.Float(), true
+	}
+	from, ok := exchangeRate(price.Currency)
+	if !ok {
+		return 0, false
+	}
+	to, ok := exchangeRate(currency)
+	if !ok {
+		return 0, false
+	}
+	return price.Float() / from * to, true
+}
+
+// Fetches the cheapest in-stock offer for a product in every compared region concurrently, converting the offers
+// into a currency.
+func fetchRegionOffers(URL string, currency string, logger *logrus.Entry) []regionOffer {
+	compared := compareRegions()
+	offers := make([]regionOffer, len(compared))
+
+	var wg sync.WaitGroup
+	for i, reg := range compared {
+		wg.Add(1)
+		go func(i int, reg string) {
+			defer wg.Done()
+			defer recoverWorker(logger.WithField("region", reg), "region offer", func() {
+				offers[i] = regionOffer{region: reg, err: errors.New("scrape panicked")}
+			})
+			offer := regionOffer{region: reg}
+
+			// the scraper's collector isn't safe to share between concurrent requests
+			start := time.Now()
+			part, err := newScraper().GetPart(regionalProductURL(URL, reg))
+			observeScrape(logger.WithField("region", reg), "part", start, err)
+			if err != nil {
+				offer.err = err
+				offers[i] = offer
+				return
+			}
+
+			found := false
+			for _, vendor := range part.Vendors {
+				if !vendor.InStock {
+					continue
+				}
+				price, err := parsePrice(vendor.Price.TotalString, reg)
+				if err != nil || price.Amount <= 0 {
+					// keep the offer so the region isn't reported as out of stock, it just can't be ranked
+					if !found && offer.vendor.URL == "" {
+						offer.vendor = vendor
+					}
+					continue
+				}
+				if !found || price.Amount < offer.price.Amount {
+					offer.vendor = vendor
+					offer.price = price
+					found = true
+				}
+			}
+			if found {
+				offer.converted, offer.hasRate = convertPrice(offer.price, currency)
+			}
+			offers[i] = offer
+		}(i, strings.ToLower(reg))
+	}
+	wg.Wait()
+
+	return offers
+}
+
+// Shows a comparison for a part in the currency of the user who asked for it.
+func displayComparison(URL string, userID string, s *discordgo.Session, m *discordgo.Message) {
+	s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Embed: &discordgo.MessageEmbed{
+			Title: "Comparing prices...",
+			Color: accent,
+		},
+		Components: []discordgo.MessageComponent{},
+		ID:         m.ID,
+		Channel:    m.ChannelID,
+	})
+
+	logger := requestLogger(m).WithField("part", URL)
+	incRequests(m.GuildID)
+	currency := userCurrency(userID)
+	offers := fetchRegionOffers(URL, currency, logger)
+
+	vendors := []gopartpicker.Vendor{}
+	sources := []linkSource{}
+	for _, offer := range offers {
+		vendors = append(vendors, offer.vendor)
+		sources = append(sources, linkSource{GuildID: m.GuildID, PartURL: regionalProductURL(URL, offer.region), RequestID: requestID(m)})
+	}
+	for i, link := range resolveVendorLinks(vendors, sources) {
+		offers[i].vendor.URL = link.URL
+	}
+
+	ranked := []regionOffer{}
+	unranked := []regionOffer{}
+	for _, offer := range offers {
+		if offer.hasRate {
+			ranked = append(ranked, offer)
+		} else {
+			unranked = append(unranked, offer)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].converted < ranked[j].converted
+	})
+
+	desc := ""
+	for i, offer := range ranked {
+		desc += fmt.Sprintf(
+			"`%v.` **%s**: %s (~%.2f %s) at [%s](%s)\n",
+			i+1,
+			strings.ToUpper(offer.region),
+			offer.vendor.Price.TotalString,
+			offer.converted,
+			currency,
+			offer.vendor.Name,
+			offer.vendor.URL,
+		)
+	}
+
+	unavailable := []string{}
+	inStock := false
+	for _, offer := range unranked {
+		inStock = inStock || (offer.err == nil && offer.vendor.URL != "")
+		reg := strings.ToUpper(offer.region)
+		switch {
+		case offer.err != nil:
+			unavailable = append(unavailable, fmt.Sprintf("**%s**: failed to fetch", reg))
+		case offer.vendor.URL == "":
+			unavailable = append(unavailable, fmt.Sprintf("**%s**: not in stock", reg))
+		case offer.price.Currency == "":
+			unavailable = append(unavailable, fmt.Sprintf("**%s**: [%s](%s) (couldn't read the price)", reg, offer.vendor.Price.TotalString, offer.vendor.URL))
+		default:
+			unavailable = append(unavailable, fmt.Sprintf("**%s**: [%s](%s) (no exchange rate)", reg, offer.vendor.Price.TotalString, offer.vendor.URL))
+		}
+	}
+
+	if desc == "" && inStock {
+		desc = "No offers could be ranked, see the other regions below.\n"
+	} else if desc == "" {
+		desc = "No in-stock offers found.\n"
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Price comparison",
+		URL:         URL,
+		Color:       accent,
+		Description: desc,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Converted to %s using configured exchange rates.", currency),
+		},
+	}
+
+	if len(unavailable) > 0 {
+		embed.Fields = []*discordgo.MessageEmbedField{
+			{
+				Name:  "Other regions",
+				Value: strings.Join(unavailable, "\n"),
+			},
+		}
+	}
+
+	s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Embed:   embed,
+		ID:      m.ID,
+		Channel: m.ChannelID,
+	})
+}
+
+func priceCompareCommand(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+	partName := args.String("partName")
+
+	mes, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title: fmt.Sprintf("Searching for '%s'...", partName),
+			Color: accent,
+		},
+		Reference: m.Reference(),
+	})
+	if err != nil {
+		return
+	}
+
+	incRequests(m.GuildID)
+	start := time.Now()
+	parts, err := scraper.SearchParts(partName, "")
+	observeScrape(requestLogger(m.Message), "search", start, err)
+	parts = limitResults(parts, args)
+
+	_, ok := err.(*gopartpicker.RedirectError)
+	if ok {
+		displayComparison(err.Error(), m.Author.ID, s, mes)
+		return
+	} else if err != nil {
+		sendError(s, err.Error(), m.ChannelID)
+		return
+	} else if len(parts) == 0 {
+		s.ChannelMessageEditEmbed(mes.ChannelID, mes.ID, &discordgo.MessageEmbed{
+			Title: fmt.Sprintf("Couldn't find part '%s'", partName),
+			Color: accent,
+		})
+		return
+	} else if len(parts) == 1 {
+		displayComparison(parts[0].URL, m.Author.ID, s, mes)
+		return
+	}
+
+	_, editErr := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Embed: &discordgo.MessageEmbed{
+			Title: fmt.Sprintf("Search results for '%s':", partName),
+			Color: accent,
+		},
+		Components: partSelectMenu(parts, "compare"),
+		ID:         mes.ID,
+		Channel:    m.ChannelID,
+	})
+
+	if editErr != nil {
+		requestLogger(m.Message).WithError(editErr).Error("Failed to show search results")
+	}
+}
@@ -1,21 +1,39 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/BurntSushi/toml"
+	"github.com/dlclark/regexp2"
+	"github.com/sirupsen/logrus"
 )
 
 type config struct {
 	Mongo        mongoConfig
 	Bot          botConfig
 	PCPartPicker pcpartpickerConfig `toml:"pcpartpicker"`
+	Tracking     trackingConfig
+	Metrics      metricsConfig
+	Health       healthConfig
+	Log          logConfig
 }
 
 type botConfig struct {
 	Token  string
 	Prefix string
+	// IDs of users allowed to use admin commands
+	Owners []string
+	// channel that reports of handler panics are sent to, none if empty
+	ErrorChannel string `toml:"error_channel"`
+	// days a guild's data is kept for after the bot is removed from it, a pointer so that 0 can be told apart from
+	// unset. Use graceDays to read it.
+	GuildGraceDays *int `toml:"guild_grace_days"`
 }
 
 type mongoConfig struct {
@@ -23,8 +41,41 @@ type mongoConfig struct {
 	DBName string `toml:"db_name"`
 }
 
+type trackingConfig struct {
+	Enabled bool
+	// address the redirect service listens on, e.g. ":8080"
+	Address string
+	// URL the redirect service can be reached at publicly
+	PublicURL string `toml:"public_url"`
+}
+
+type metricsConfig struct {
+	Enabled bool
+	// address the Prometheus metrics endpoint listens on, e.g. ":9090"
+	Address string
+}
+
+type healthConfig struct {
+	Enabled bool
+	// address the /healthz and /readyz endpoints listen on, e.g. ":8081"
+	Address string
+}
+
+type logConfig struct {
+	// one of trace, debug, info, warn or error, defaults to info
+	Level string
+	// either text or json, defaults to text
+	Format string
+}
+
 type pcpartpickerConfig struct {
 	Affiliates []affiliate
+	// regions used by the pricecompare command
+	CompareRegions []string `toml:"compare_regions"`
+	// ISO code of the currency comparisons are converted into
+	BaseCurrency string `toml:"base_currency"`
+	// units of each currency per one unit of the base currency
+	Rates map[string]float64
 	// unused... for now
 	Proxies map[string]proxy
 }
@@ -34,6 +85,9 @@ type affiliate struct {
 	Code            string
 	FullRegexp      string `toml:"full_regexp"`
 	ExtractIDRegexp string `toml:"extract_id_regexp"`
+
+	fullRegexp      *regexp2.Regexp
+	extractIDRegexp *regexp2.Regexp
 }
 
 type proxy struct {
@@ -41,16 +95,257 @@ type proxy struct {
 	CfClearance string `toml:"cf_clearance"`
 }
 
-func getConfig(fileName string) *config {
+const (
+	envPrefix             = "PARTSBOT"
+	defaultGuildGraceDays = 30
+)
+
+var currentConf atomic.Value
+
+// Returns the days a guild's data is kept for after the bot is removed from it.
+func (b botConfig) graceDays() int {
+	if b.GuildGraceDays == nil {
+		return defaultGuildGraceDays
+	}
+	return *b.GuildGraceDays
+}
+
+// Gets the currently loaded config. The config can be swapped out by a reload at any time, so callers that read
+// several related values should keep hold of the returned pointer.
+func conf() *config {
+	c, _ := currentConf.Load().(*config)
+	return c
+}
+
+func setConf(c *config) {
+	currentConf.Store(c)
+}
+
+// Loads the config from a TOML file, applies environment variable overrides and validates it. The file may be
+// missing if everything required is set through the environment.
+func getConfig(fileName string) (*config, error) {
 	var conf config
 
-	dat, _ := os.ReadFile(fileName)
+	dat, err := os.ReadFile(fileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read config file %s: %w", fileName, err)
+	}
+	fileMissing := err != nil
+
+	if _, err := toml.Decode(string(dat), &conf); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", fileName, err)
+	}
+
+	if err := applyEnvOverrides(reflect.ValueOf(&conf).Elem(), envPrefix); err != nil {
+		return nil, err
+	}
+
+	if conf.Bot.Prefix == "" {
+		conf.Bot.Prefix = "."
+	}
+	if conf.Bot.GuildGraceDays == nil {
+		graceDays := defaultGuildGraceDays
+		conf.Bot.GuildGraceDays = &graceDays
+	}
+
+	if errs := conf.validate(); len(errs) > 0 {
+		msg := "invalid config:\n  " + strings.Join(errs, "\n  ")
+		if fileMissing {
+			msg += fmt.Sprintf("\n(config file %s was not found)", fileName)
+		}
+		return nil, errors.New(msg)
+	}
+
+	// currencies are looked up by their upper case codes everywhere else
+	rates := make(map[string]float64, len(conf.PCPartPicker.Rates))
+	for currency, rate := range conf.PCPartPicker.Rates {
+		rates[strings.ToUpper(currency)] = rate
+	}
+	conf.PCPartPicker.Rates = rates
+	conf.PCPartPicker.BaseCurrency = strings.ToUpper(conf.PCPartPicker.BaseCurrency)
+
+	return &conf, nil
+}
 
-	_, err := toml.Decode(string(dat), &conf)
+// Overrides config fields with environment variables named after their TOML keys, e.g. PARTSBOT_BOT_TOKEN or
+// PARTSBOT_MONGO_DB_NAME. Lists are comma separated, while maps and lists of tables are given as TOML inline tables
+// and arrays, e.g. PARTSBOT_PCPARTPICKER_RATES='{ GBP = 0.79 }'.
+func applyEnvOverrides(v reflect.Value, prefix string) error {
+	t := v.Type()
 
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		key := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if key == "" {
+			key = field.Name
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(fv, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		// optional values are pointers, so they need something to point to
+		if fv.Kind() == reflect.Ptr {
+			fv.Set(reflect.New(fv.Type().Elem()))
+			fv = fv.Elem()
+		}
+
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(val)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+			fv.SetBool(b)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+			fv.SetInt(n)
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+			fv.SetFloat(f)
+		case reflect.Map:
+			if err := decodeEnvTOML(val, fv); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() != reflect.String {
+				if err := decodeEnvTOML(val, fv); err != nil {
+					return fmt.Errorf("invalid value for %s: %w", name, err)
+				}
+				continue
+			}
+			items := []string{}
+			for _, item := range strings.Split(val, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			fv.Set(reflect.ValueOf(items))
+		}
+	}
+
+	return nil
+}
+
+// Decodes an inline TOML value, such as a table or an array of tables, into a config field.
+func decodeEnvTOML(val string, fv reflect.Value) error {
+	var doc map[string]toml.Primitive
+	md, err := toml.Decode("value = "+val, &doc)
 	if err != nil {
-		fmt.Println(err)
+		return err
+	}
+	decoded := reflect.New(fv.Type())
+	if err := md.PrimitiveDecode(doc["value"], decoded.Interface()); err != nil {
+		return err
+	}
+	fv.Set(decoded.Elem())
+	return nil
+}
+
+// Checks the config for missing or invalid values, returning every problem found.
+func (c *config) validate() []string {
+	errs := []string{}
+
+	if c.Bot.Token == "" {
+		errs = append(errs, "bot.token is required")
+	}
+	if c.Mongo.URI == "" {
+		errs = append(errs, "mongo.uri is required")
+	}
+	if c.Mongo.DBName == "" {
+		errs = append(errs, "mongo.db_name is required")
+	}
+	if c.Bot.graceDays() < 0 {
+		errs = append(errs, "bot.guild_grace_days can't be negative")
+	}
+
+	if c.Tracking.Enabled {
+		if c.Tracking.Address == "" {
+			errs = append(errs, "tracking.address is required when tracking is enabled")
+		}
+		if c.Tracking.PublicURL == "" {
+			errs = append(errs, "tracking.public_url is required when tracking is enabled")
+		}
+	}
+	if c.Metrics.Enabled && c.Metrics.Address == "" {
+		errs = append(errs, "metrics.address is required when metrics are enabled")
+	}
+	if c.Health.Enabled && c.Health.Address == "" {
+		errs = append(errs, "health.address is required when health checks are enabled")
+	}
+	if c.Log.Level != "" {
+		if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+			errs = append(errs, fmt.Sprintf("log.level: unknown level %s", c.Log.Level))
+		}
+	}
+	if f := strings.ToLower(c.Log.Format); f != "" && f != "text" && f != "json" {
+		errs = append(errs, "log.format must be text or json")
+	}
+
+	for _, reg := range c.PCPartPicker.CompareRegions {
+		if _, ok := regionCurrencies[strings.ToLower(reg)]; !ok {
+			errs = append(errs, fmt.Sprintf("pcpartpicker.compare_regions: unknown region %s", reg))
+		}
+	}
+	seen := map[string]bool{}
+	for currency, rate := range c.PCPartPicker.Rates {
+		if rate <= 0 {
+			errs = append(errs, fmt.Sprintf("pcpartpicker.rates: rate for %s must be positive", currency))
+		}
+		if seen[strings.ToUpper(currency)] {
+			errs = append(errs, fmt.Sprintf("pcpartpicker.rates: %s is set more than once", strings.ToUpper(currency)))
+		}
+		seen[strings.ToUpper(currency)] = true
+	}
+
+	return append(errs, c.PCPartPicker.compileAffiliates()...)
+}
+
+// Compiles the regexes of every affiliate, returning a list of invalid patterns.
+func (c *pcpartpickerConfig) compileAffiliates() []string {
+	errs := []string{}
+
+	for i := range c.Affiliates {
+		aff := &c.Affiliates[i]
+
+		if aff.FullRegexp == "" {
+			errs = append(errs, fmt.Sprintf("affiliate %s: full_regexp is required", aff.Name))
+		} else if re, err := regexp2.Compile(aff.FullRegexp, 0); err != nil {
+			errs = append(errs, fmt.Sprintf("affiliate %s: invalid full_regexp: %s", aff.Name, err.Error()))
+		} else {
+			aff.fullRegexp = re
+		}
+
+		if aff.ExtractIDRegexp == "" {
+			continue
+		}
+		if re, err := regexp2.Compile(aff.ExtractIDRegexp, 0); err != nil {
+			errs = append(errs, fmt.Sprintf("affiliate %s: invalid extract_id_regexp: %s", aff.Name, err.Error()))
+		} else {
+			aff.extractIDRegexp = re
+		}
 	}
 
-	return &conf
+	return errs
 }
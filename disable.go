@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Returns the settings subcommands that turn commands off and on in a guild or channel.
+func commandToggleCommand() command {
+	return command{
+		name:        "commands",
+		description: "Turns commands off or on in the whole server or in a single channel.",
+		permissions: discordgo.PermissionManageServer,
+		subcommands: []command{
+			{
+				name:        "disable",
+				description: "Turns a command off in the server, or only in a channel if one is given.",
+				handler:     toggleCommandHandler(true),
+				args:        []string{"<command>", "[--channel:channel]"},
+				permissions: discordgo.PermissionManageServer,
+				examples:    []string{"settings commands disable specs", "settings commands disable price --channel #general"},
+			},
+			{
+				name:        "enable",
+				description: "Turns a disabled command back on in the server, or only in a channel if one is given.",
+				handler:     toggleCommandHandler(false),
+				args:        []string{"<command>", "[--channel:channel]"},
+				permissions: discordgo.PermissionManageServer,
+				examples:    []string{"settings commands enable specs", "settings commands enable price --channel #general"},
+			},
+			{
+				name:        "list",
+				description: "Shows the commands that are turned off in the server and its channels.",
+				handler:     disabledCommandsCommand,
+				permissions: discordgo.PermissionManageServer,
+				examples:    []string{"settings commands list"},
+			},
+		},
+	}
+}
+
+// Checks whether a command, or a command it's a subcommand of, is turned off in a guild or one of its channels.
+func isCommandDisabled(g guild, channelID string, path string) bool {
+	disabled := map[string]bool{}
+	for _, name := range g.DisabledCommands {
+		disabled[name] = true
+	}
+	for _, name := range g.DisabledChannels[channelID] {
+		disabled[name] = true
+	}
+
+	words := strings.Split(path, " ")
+	for i := range words {
+		if disabled[strings.Join(words[:i+1], " ")] {
+			return true
+		}
+	}
+	return false
+}
+
+// Replies to a disabled command if the guild wants to know about it.
+func sendCommandDisabled(s *discordgo.Session, m *discordgo.MessageCreate, g guild) {
+	if g.Settings&settingFlags["disabledreplies"] == 0 {
+		return
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title: "This command is disabled here.",
+			Color: accent,
+		},
+		Reference: m.Reference(),
+	})
+}
+
+// Returns the handler of the subcommand that turns a command off or on.
+func toggleCommandHandler(disable bool) func(*discordgo.Session, *discordgo.MessageCreate, commandArgs) {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+		comm := router.resolveCommand(args.String("command"))
+		if comm == nil || (comm.ownerOnly && !isOwner(m.Author.ID)) {
+			sendError(s, fmt.Sprintf("Couldn't find command '%s'.", args.String("command")), m.ChannelID)
+			return
+		}
+		// turning off settings would lock the server out of turning them back on
+		if strings.HasPrefix(comm.path, "settings") || comm.ownerOnly {
+			sendError(s, fmt.Sprintf("`%s` can't be disabled.", comm.path), m.ChannelID)
+			return
+		}
+
+		field := "disabled_commands"
+		where := "this server"
+		if args.Has("channel") {
+			channel, err := s.State.Channel(args.String("channel"))
+			if err != nil {
+				channel, err = s.Channel(args.String("channel"))
+			}
+			if err != nil || channel.GuildID != m.GuildID {
+				sendError(s, "That channel isn't in this server.", m.ChannelID)
+				return
+			}
+			field = "disabled_channels." + channel.ID
+			where = fmt.Sprintf("<#%s>", channel.ID)
+		}
+
+		op := "$pull"
+		state := "enabled"
+		if disable {
+			op = "$addToSet"
+			state = "disabled"
+		}
+
+		_, err := db.Collection("guilds").UpdateOne(ctx, bson.M{
+			"id": m.GuildID,
+		}, bson.M{
+			op: bson.M{
+				field: comm.path,
+			},
+		})
+		if err != nil {
+			requestLogger(m.Message).WithError(err).Error("failed to update disabled commands")
+			sendError(s, "Failed to update this server's settings.", m.ChannelID)
+			return
+		}
+
+		desc := fmt.Sprintf("`%s` is now **%s** in %s.", comm.path, state, where)
+		if !disable && args.Has("channel") {
+			g, err := getGuildState(m.GuildID)
+			if err == nil && isCommandDisabled(g, "", comm.path) {
+				desc += " It's still disabled in the whole server."
+			}
+		}
+
+		s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+			Embed: &discordgo.MessageEmbed{
+				Description: desc,
+				Color:       accent,
+			},
+			Reference: m.Reference(),
+		})
+	}
+}
+
+func disabledCommandsCommand(s *discordgo.Session, m *discordgo.MessageCreate, _ commandArgs) {
+	g, err := getGuildState(m.GuildID)
+	if err != nil {
+		sendError(s, "Failed to load this server's settings.", m.ChannelID)
+		return
+	}
+
+	fields := []*discordgo.MessageEmbedField{}
+	if len(g.DisabledCommands) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Server",
+			Value: commandNameList(g.DisabledCommands),
+		})
+	}
+
+	channelIDs := []string{}
+	for channelID, names := range g.DisabledChannels {
+		if len(names) > 0 {
+			channelIDs = append(channelIDs, channelID)
+		}
+	}
+	sort.Strings(channelIDs)
+	for _, channelID := range channelIDs {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  channelName(s, channelID),
+			Value: commandNameList(g.DisabledChannels[channelID]),
+		})
+	}
+
+	desc := ""
+	if len(fields) == 0 {
+		desc = "No commands are disabled."
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title:       "Disabled commands",
+			Description: desc,
+			Color:       accent,
+			Fields:      fields,
+		},
+		Reference: m.Reference(),
+	})
+}
+
+func commandNameList(names []string) string {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	return "`" + strings.Join(sorted, "`, `") + "`"
+}
+
+// Returns a channel's name for embed field names, which can't contain channel mentions.
+func channelName(s *discordgo.Session, channelID string) string {
+	if channel, err := s.State.Channel(channelID); err == nil {
+		return "#" + channel.Name
+	}
+	return channelID
+}
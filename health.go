@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	dbPingTimeout = 2 * time.Second
+	// how long the scraper can go without a successful request after failing before it's reported as down
+	scrapeStaleAfter = time.Hour
+	// how long in-flight handlers get to finish when shutting down
+	drainTimeout = 30 * time.Second
+)
+
+var (
+	gatewayConnected int32
+	draining         int32
+	lastScrapeOK     int64
+	lastScrapeFailed int64
+	inFlight         sync.WaitGroup
+	// held while starting a handler and while starting to drain, so no handler can start once the drain has begun
+	inFlightMutex sync.Mutex
+)
+
+type healthReport struct {
+	Status           string     `json:"status"`
+	Gateway          bool       `json:"gateway"`
+	Database         bool       `json:"database"`
+	DatabaseError    string     `json:"database_error,omitempty"`
+	Scraper          bool       `json:"scraper"`
+	LastScrape       *time.Time `json:"last_successful_scrape,omitempty"`
+	LastScrapeFailed *time.Time `json:"last_failed_scrape,omitempty"`
+	Draining         bool       `json:"draining"`
+}
+
+func gatewayConnect(_ *discordgo.Session, _ *discordgo.Connect) {
+	atomic.StoreInt32(&gatewayConnected, 1)
+}
+
+func gatewayDisconnect(_ *discordgo.Session, _ *discordgo.Disconnect) {
+	atomic.StoreInt32(&gatewayConnected, 0)
+}
+
+// Records the time of a scrape for the readiness check.
+func recordScrape(ok bool) {
+	if ok {
+		atomic.StoreInt64(&lastScrapeOK, time.Now().UnixNano())
+	} else {
+		atomic.StoreInt64(&lastScrapeFailed, time.Now().UnixNano())
+	}
+}
+
+func loadTime(addr *int64) *time.Time {
+	nano := atomic.LoadInt64(addr)
+	if nano == 0 {
+		return nil
+	}
+	t := time.Unix(0, nano)
+	return &t
+}
+
+// Starts tracking a handler so shutdown can wait for it. Returns false if the bot is shutting down and the event
+// should be ignored.
+func beginHandler() bool {
+	inFlightMutex.Lock()
+	defer inFlightMutex.Unlock()
+
+	if atomic.LoadInt32(&draining) == 1 {
+		return false
+	}
+	inFlight.Add(1)
+	return true
+}
+
+// Stops accepting new events and waits for in-flight handlers to finish, giving up after the drain timeout.
+func drainHandlers() {
+	inFlightMutex.Lock()
+	atomic.StoreInt32(&draining, 1)
+	inFlightMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("All handlers finished")
+	case <-time.After(drainTimeout):
+		log.Warn("Timed out waiting for handlers to finish")
+	}
+}
+
+func checkHealth() healthReport {
+	report := healthReport{
+		Gateway:          atomic.LoadInt32(&gatewayConnected) == 1,
+		LastScrape:       loadTime(&lastScrapeOK),
+		LastScrapeFailed: loadTime(&lastScrapeFailed),
+		Draining:         atomic.LoadInt32(&draining) == 1,
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, dbPingTimeout)
+	defer cancel()
+	if err := db.Client().Ping(pingCtx, nil); err != nil {
+		report.DatabaseError = err.Error()
+	} else {
+		report.Database = true
+	}
+
+	// an idle scraper is fine, it's only down if it has failed since its last success and that was a while ago
+	report.Scraper = report.LastScrapeFailed == nil ||
+		(report.LastScrape != nil && (report.LastScrape.After(*report.LastScrapeFailed) || time.Since(*report.LastScrape) < scrapeStaleAfter))
+
+	report.Status = "ok"
+	if !report.Gateway || !report.Database || !report.Scraper || report.Draining {
+		report.Status = "unavailable"
+	}
+	return report
+}
+
+func writeHealth(w http.ResponseWriter, report healthReport, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Reports whether the process is alive. This only fails while shutting down, so a gateway reconnect or a database
+// outage doesn't get the bot restarted.
+func healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	report := checkHealth()
+	writeHealth(w, report, !report.Draining)
+}
+
+// Reports whether the bot can serve requests: the gateway is connected, the database is reachable and the scraper is
+// working.
+func readyzHandler(w http.ResponseWriter, _ *http.Request) {
+	report := checkHealth()
+	writeHealth(w, report, report.Status == "ok")
+}
+
+// Starts the health check endpoints.
+func startHealthServer() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+
+	log.WithField("address", conf().Health.Address).Info("Starting health endpoints")
+	server := &http.Server{
+		Addr:              conf().Health.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		log.WithError(err).Error("Health endpoints stopped")
+	}
+}
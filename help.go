@@ -2,11 +2,22 @@ package main
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+// Command categories in the order help shows them. Commands without a category are listed under General.
+var helpCategories = []string{"Parts", "Builds", "Settings", "General", "Admin"}
+
+// A page of the help menu, one per category.
+type helpPage struct {
+	category string
+	commands []command
+}
+
 func init() {
 	router.addCommand(
 		command{
@@ -15,18 +26,108 @@ func init() {
 			args:        []string{"[commandName]"},
 			handler:     helpCommand,
 			aliases:     []string{"commands"},
+			category:    "General",
+			examples:    []string{"help", "help price", "help settings price"},
 		},
 	)
+	router.addSubhandler(3, "helppage", helpPageHandler)
+}
+
+// Groups the commands a user can see into pages by category, sorted by name.
+func helpPages(userID string) []helpPage {
+	byCategory := map[string][]command{}
+	for _, comm := range router.commands {
+		if comm.ownerOnly && !isOwner(userID) {
+			continue
+		}
+		category := comm.category
+		if category == "" {
+			category = "General"
+		}
+		byCategory[category] = append(byCategory[category], comm)
+	}
+
+	pages := []helpPage{}
+	for _, category := range helpCategories {
+		commands := byCategory[category]
+		if len(commands) == 0 {
+			continue
+		}
+		sort.Slice(commands, func(i, j int) bool {
+			return commands[i].path < commands[j].path
+		})
+		pages = append(pages, helpPage{category: category, commands: commands})
+	}
+	return pages
+}
+
+// Formats a command's examples with the prefix.
+func (c command) exampleList() string {
+	examples := []string{}
+	for _, example := range c.examples {
+		examples = append(examples, fmt.Sprintf("`%s%s`", conf().Bot.Prefix, example))
+	}
+	return strings.Join(examples, "\n")
+}
+
+func helpPageEmbed(pages []helpPage, page int) *discordgo.MessageEmbed {
+	fields := []*discordgo.MessageEmbedField{}
+	for _, comm := range pages[page].commands {
+		value := comm.description
+		if len(comm.examples) > 0 {
+			value += fmt.Sprintf("\nExample: `%s%s`", conf().Bot.Prefix, comm.examples[0])
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  comm.Usage(),
+			Value: value,
+		})
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("%s commands", pages[page].category),
+		Description: fmt.Sprintf("The prefix is `%s`, or mention the bot instead. Use `%shelp <command>` for more about a command.", conf().Bot.Prefix, conf().Bot.Prefix),
+		Color:       accent,
+		Fields:      fields,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Page %v/%v", page+1, len(pages)),
+		},
+	}
 }
 
-func helpCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-	if len(args) > 0 {
-		commName := strings.ToLower(args[0])
-		comm := router.getCommand(commName)
+// Builds the previous and next buttons, which carry the page they go to.
+func helpPageComponents(pages []helpPage, page int) []discordgo.MessageComponent {
+	if len(pages) < 2 {
+		return []discordgo.MessageComponent{}
+	}
 
-		if comm == nil {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Previous",
+					Style:    discordgo.SecondaryButton,
+					CustomID: fmt.Sprintf("helpPage %v", page-1),
+					Disabled: page == 0,
+				},
+				discordgo.Button{
+					Label:    "Next",
+					Style:    discordgo.SecondaryButton,
+					CustomID: fmt.Sprintf("helpPage %v", page+1),
+					Disabled: page >= len(pages)-1,
+				},
+			},
+		},
+	}
+}
+
+func helpCommand(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+	if args.Has("commandName") {
+		comm := router.resolveCommand(args.String("commandName"))
+
+		if comm == nil || (comm.ownerOnly && !isOwner(m.Author.ID)) {
 			s.ChannelMessageSendEmbed(m.ChannelID, &discordgo.MessageEmbed{
-				Title: fmt.Sprintf("Couldn't find command '%s'.", args[0]),
+				Title: fmt.Sprintf("Couldn't find command '%s'.", args.String("commandName")),
+				Color: accent,
 			})
 			return
 		}
@@ -42,30 +143,59 @@ func helpCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string
 			},
 		}
 
+		if len(comm.examples) > 0 {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  "Examples",
+				Value: comm.exampleList(),
+			})
+		}
 		if len(comm.aliases) > 0 {
 			fields = append(fields, &discordgo.MessageEmbedField{
 				Name:  "Aliases",
 				Value: strings.Join(comm.aliases, ", "),
 			})
 		}
+		if comm.permissions != 0 {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  "Permissions",
+				Value: permissionNames(comm.permissions),
+			})
+		}
+		if subs := subcommandList(*comm, m.Author.ID); subs != "" {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  "Subcommands",
+				Value: subs,
+			})
+		}
 
 		s.ChannelMessageSendEmbed(m.ChannelID, &discordgo.MessageEmbed{
-			Title:  comm.name,
+			Title:  comm.path,
 			Color:  accent,
 			Fields: fields,
 		})
 		return
 	}
 
-	commands := []string{}
+	pages := helpPages(m.Author.ID)
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed:      helpPageEmbed(pages, 0),
+		Components: helpPageComponents(pages, 0),
+		Reference:  m.Reference(),
+	})
+}
 
-	for n := range router.commands {
-		commands = append(commands, n)
+func helpPageHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	pages := helpPages(interactionUserID(i))
+	page, err := strconv.Atoi(strings.Split(i.MessageComponentData().CustomID, " ")[1])
+	if err != nil || page < 0 || page >= len(pages) {
+		page = 0
 	}
 
-	s.ChannelMessageSendEmbed(m.ChannelID, &discordgo.MessageEmbed{
-		Title:       "Commands",
-		Description: strings.Join(commands, ", "),
-		Color:       accent,
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{helpPageEmbed(pages, page)},
+			Components: helpPageComponents(pages, page),
+		},
 	})
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+// Applies the configured log level and format.
+func setupLogging(c logConfig) error {
+	level := logrus.InfoLevel
+	if c.Level != "" {
+		parsed, err := logrus.ParseLevel(c.Level)
+		if err != nil {
+			return err
+		}
+		level = parsed
+	}
+
+	switch strings.ToLower(c.Format) {
+	case "", "text":
+		log.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	case "json":
+		log.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown format %s", c.Format)
+	}
+
+	log.SetLevel(level)
+	return nil
+}
+
+// Returns the correlation ID of the request a message belongs to, which is the ID of the user's message that started
+// it. The bot's replies reference that message, so edits to them and button presses on them share its ID.
+func requestID(m *discordgo.Message) string {
+	if m.Author != nil && m.Author.Bot && m.MessageReference != nil && m.MessageReference.MessageID != "" {
+		return m.MessageReference.MessageID
+	}
+	return m.ID
+}
+
+// Returns a logger tagged with the request a message belongs to.
+func requestLogger(m *discordgo.Message) *logrus.Entry {
+	return log.WithFields(logrus.Fields{
+		"request_id": requestID(m),
+		"guild":      m.GuildID,
+		"channel":    m.ChannelID,
+	})
+}
+
+// Returns a logger tagged with the request a component interaction belongs to.
+func interactionLogger(i *discordgo.InteractionCreate) *logrus.Entry {
+	fields := logrus.Fields{
+		"interaction": i.ID,
+		"guild":       i.GuildID,
+		"channel":     i.ChannelID,
+	}
+	if i.Message != nil {
+		fields["request_id"] = requestID(i.Message)
+	}
+	if userID := interactionUserID(i); userID != "" {
+		fields["user"] = userID
+	}
+	return log.WithFields(fields)
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,11 +17,13 @@ import (
 )
 
 const (
-	accent = 0x1e807c
+	accent               = 0x1e807c
+	guildCleanupInterval = time.Hour
+	// version of the guild document layout, bump it with a migration when the guild struct changes
+	guildSchemaVersion = 2
 )
 
 var (
-	conf    = getConfig("config.toml")
 	router  = newRouter()
 	ctx     = context.TODO()
 	db      *mongo.Database
@@ -27,28 +31,71 @@ var (
 )
 
 type guild struct {
-	ID       string `bson:"id"`
-	Settings int
-	Requests int
+	SchemaVersion int    `bson:"schema_version"`
+	ID            string `bson:"id"`
+	Settings      int
+	Requests      int
+	// channel announcements are sent to, empty if the guild hasn't opted in
+	AnnouncementChannel string    `bson:"announcement_channel"`
+	JoinedAt            time.Time `bson:"joined_at"`
+	// set when the bot is removed from the guild, the guild's data is deleted once the grace period has passed
+	Inactive bool      `bson:"inactive"`
+	LeftAt   time.Time `bson:"left_at,omitempty"`
+	// commands turned off in the whole guild, by their full name. Left out rather than stored as null when empty,
+	// which $addToSet and $pull can't work on.
+	DisabledCommands []string `bson:"disabled_commands,omitempty"`
+	// commands turned off in specific channels, keyed by channel ID
+	DisabledChannels map[string][]string `bson:"disabled_channels,omitempty"`
 }
 
-func getGuildState(ID string) guild {
+// Gets a guild's stored state. Guilds without a document, such as DMs, get the zero value.
+func getGuildState(ID string) (guild, error) {
 	var g guild
-	doc := db.Collection("guilds").FindOne(ctx, bson.M{
+	err := db.Collection("guilds").FindOne(ctx, bson.M{
 		"id": ID,
-	})
-	doc.Decode(&g)
-	return g
+	}).Decode(&g)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return guild{}, nil
+	} else if err != nil {
+		log.WithError(err).WithField("guild", ID).Error("Failed to load guild")
+		return guild{}, err
+	}
+	return g, nil
 }
 
 func main() {
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(conf.Mongo.URI))
+	configPath := flag.String("config", "config.toml", "path to the config file")
+	flag.Parse()
+
+	c, err := getConfig(*configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
-	db = client.Database(conf.Mongo.DBName)
+	if err := setupLogging(c.Log); err != nil {
+		log.Fatal(err)
+	}
+	setConf(c)
+	configFile = *configPath
 
-	dg, err := discordgo.New("Bot " + conf.Bot.Token)
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(conf().Mongo.URI))
+	if err != nil {
+		log.Fatal(err)
+	}
+	db = client.Database(conf().Mongo.DBName)
+
+	if err := runMigrations(); err != nil {
+		log.Fatal(err)
+	}
+
+	if conf().Tracking.Enabled {
+		go startTrackingServer()
+	}
+
+	setupScraper()
+	go watchConfig()
+	go cleanupGuildsLoop()
+
+	dg, err := discordgo.New("Bot " + conf().Bot.Token)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -56,6 +103,10 @@ func main() {
 	dg.AddHandler(messageCreate)
 	dg.AddHandler(interactionCreate)
 	dg.AddHandler(guildCreate)
+	dg.AddHandler(guildDelete)
+	dg.AddHandler(ready)
+	dg.AddHandler(gatewayConnect)
+	dg.AddHandler(gatewayDisconnect)
 
 	dg.Identify.Intents = discordgo.IntentsAll
 
@@ -64,14 +115,22 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if conf().Metrics.Enabled {
+		go startMetricsServer(dg)
+	}
+	if conf().Health.Enabled {
+		go startHealthServer()
+	}
+
 	botPing = fmt.Sprintf("<@%s>", dg.State.User.ID)
-	log.Printf("Bot logged in as %s#%s.\n", dg.State.User.Username, dg.State.User.Discriminator)
+	log.Infof("Bot logged in as %s#%s", dg.State.User.Username, dg.State.User.Discriminator)
 
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
-	log.Println("Bot is shutting down...")
+	log.Info("Bot is shutting down, waiting for handlers to finish")
+	drainHandlers()
 	dg.Close()
 }
 
@@ -80,6 +139,12 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 	if m.Author.ID == s.State.User.ID {
 		return
 	}
+	if !beginHandler() {
+		return
+	}
+	defer inFlight.Done()
+	defer recoverHandler(s, requestLogger(m.Message).WithField("user", m.Author.ID), m.ChannelID, "message")
+
 	ok := processCommands(s, m)
 	if ok {
 		return
@@ -94,24 +159,114 @@ func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	case 3:
 		handler = router.getSubhandler(int(i.Type), i.MessageComponentData().CustomID)
 	}
-	if handler == nil {
+	if handler == nil || !beginHandler() {
 		return
 	}
+	defer inFlight.Done()
+
+	customID := i.MessageComponentData().CustomID
+	logger := interactionLogger(i).WithField("component", customID)
+	defer recoverHandler(s, logger, i.ChannelID, "component "+customID)
+
+	logger.Debug("Handling component")
 	handler(s, i)
 }
 
-// Handles guild create events for adding guilds to the database upon joining
+// Handles guild create events for adding guilds to the database upon joining, or restoring them if the bot is
+// re-added within the grace period
 func guildCreate(s *discordgo.Session, g *discordgo.GuildCreate) {
 	doc := db.Collection("guilds").FindOne(ctx, bson.M{
 		"id": g.ID,
 	})
 	var dbGuild guild
-	if err := doc.Decode(&dbGuild); errors.Is(err, mongo.ErrNoDocuments) {
-		log.Printf("Joined a new server: \"%s\" ID: %s\n", g.Name, g.ID)
+	err := doc.Decode(&dbGuild)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		log.WithField("guild", g.ID).Infof("Joined a new server: %s", g.Name)
 		db.Collection("guilds").InsertOne(ctx, guild{
-			ID:       g.ID,
-			Settings: defaultSettings,
-			Requests: 0,
+			SchemaVersion: guildSchemaVersion,
+			ID:            g.ID,
+			Settings:      defaultSettings,
+			Requests:      0,
+			JoinedAt:      time.Now(),
+		})
+	} else if err == nil && dbGuild.Inactive {
+		log.WithField("guild", g.ID).Infof("Rejoined a server, restoring its settings: %s", g.Name)
+		db.Collection("guilds").UpdateOne(ctx, bson.M{
+			"id": g.ID,
+		}, bson.M{
+			"$set": bson.M{
+				"inactive":  false,
+				"joined_at": time.Now(),
+			},
+			"$unset": bson.M{
+				"left_at": "",
+			},
 		})
 	}
 }
+
+// Handles guild delete events for marking guilds as inactive when the bot is removed
+func guildDelete(s *discordgo.Session, g *discordgo.GuildDelete) {
+	// guilds also become unavailable during outages, which doesn't mean the bot was removed
+	if g.Unavailable {
+		return
+	}
+	log.WithField("guild", g.ID).Info("Left a server")
+	db.Collection("guilds").UpdateOne(ctx, bson.M{
+		"id": g.ID,
+	}, bson.M{
+		"$set": bson.M{
+			"inactive": true,
+			"left_at":  time.Now(),
+		},
+	})
+}
+
+// Marks guilds the bot was removed from while it was offline as inactive, since they never get a guild delete event.
+// Ready lists every guild the bot is in, so any active guild missing from it has been left.
+func ready(s *discordgo.Session, r *discordgo.Ready) {
+	ids := []string{}
+	for _, g := range r.Guilds {
+		ids = append(ids, g.ID)
+	}
+
+	res, err := db.Collection("guilds").UpdateMany(ctx, bson.M{
+		"id":       bson.M{"$nin": ids},
+		"inactive": bson.M{"$ne": true},
+	}, bson.M{
+		"$set": bson.M{
+			"inactive": true,
+			"left_at":  time.Now(),
+		},
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to reconcile guilds")
+		return
+	}
+	if res.ModifiedCount > 0 {
+		log.Infof("Marked %v server(s) the bot was removed from while offline as inactive", res.ModifiedCount)
+	}
+}
+
+// Deletes the data of guilds that have been inactive for longer than the grace period
+func cleanupGuilds() {
+	cutoff := time.Now().AddDate(0, 0, -conf().Bot.graceDays())
+	res, err := db.Collection("guilds").DeleteMany(ctx, bson.M{
+		"inactive": true,
+		"left_at":  bson.M{"$lt": cutoff},
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to clean up inactive guilds")
+		return
+	}
+	if res.DeletedCount > 0 {
+		log.Infof("Deleted data for %v server(s) the bot left over %v day(s) ago", res.DeletedCount, conf().Bot.graceDays())
+	}
+}
+
+func cleanupGuildsLoop() {
+	for {
+		cleanupGuilds()
+		time.Sleep(guildCleanupInterval)
+	}
+}
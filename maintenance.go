@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	backupDir           = "backups"
+	maxBackupUploadSize = 8 << 20
+	purgeConfirmTimeout = 2 * time.Minute
+)
+
+// A destructive database operation waiting to be confirmed.
+type pendingPurge struct {
+	userID     string
+	collection string
+	filter     bson.M
+	summary    string
+	expires    time.Time
+}
+
+var (
+	pendingPurges      = map[string]pendingPurge{}
+	pendingPurgesMutex sync.Mutex
+)
+
+func init() {
+	router.addCommand(
+		command{
+			name:        "Purge",
+			description: "Deletes affiliate URL cache entries or clicks older than a number of days, or servers the bot has left. Shows how many documents would be deleted and asks for confirmation first.",
+			args:        []string{"<target:urls|clicks|guilds>", "[days:int]"},
+			handler:     purgeCommand,
+			category:    "Admin",
+			examples:    []string{"purge urls 30", "purge guilds"},
+			aliases:     []string{"dbpurge"},
+			ownerOnly:   true,
+		},
+	)
+	router.addSubhandler(3, "purge", purgeConfirmHandler)
+}
+
+// Builds the collection and filter for a purge target.
+func purgeFilter(target string, days int) (string, bson.M, string) {
+	olderThan := func(field string) bson.M {
+		if days <= 0 {
+			return bson.M{}
+		}
+		cutoff := time.Now().AddDate(0, 0, -days)
+		return bson.M{"$or": []bson.M{
+			{field: bson.M{"$lt": cutoff}},
+			{field: bson.M{"$exists": false}},
+		}}
+	}
+	age := "all"
+	if days > 0 {
+		age = fmt.Sprintf("older than %v day(s)", days)
+	}
+
+	switch target {
+	case "urls":
+		return "urls", olderThan("created"), fmt.Sprintf("affiliate URL cache entries (%s)", age)
+	case "clicks":
+		return "clicks", olderThan("time"), fmt.Sprintf("affiliate clicks (%s)", age)
+	default:
+		// only servers the bot was removed from, and never within the grace period in which they can be restored.
+		// Relying on the state's guild list instead would wipe live servers whenever the state is incomplete.
+		if days < conf().Bot.graceDays() {
+			days = conf().Bot.graceDays()
+		}
+		return "guilds", bson.M{
+			"inactive": true,
+			"left_at":  bson.M{"$lt": time.Now().AddDate(0, 0, -days)},
+		}, fmt.Sprintf("servers the bot left over %v day(s) ago", days)
+	}
+}
+
+func purgeCommand(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+	target := args.String("target")
+	days := args.Int("days")
+	if days < 0 {
+		sendError(s, "Days must be a positive number.", m.ChannelID)
+		return
+	}
+
+	collection, filter, summary := purgeFilter(target, days)
+	count, err := db.Collection(collection).CountDocuments(ctx, filter)
+	if err != nil {
+		sendError(s, fmt.Sprintf("Failed to count documents: %s", err.Error()), m.ChannelID)
+		return
+	}
+
+	if count == 0 {
+		s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+			Embed: &discordgo.MessageEmbed{
+				Description: fmt.Sprintf("No %s to delete.", summary),
+				Color:       accent,
+			},
+			Reference: m.Reference(),
+		})
+		return
+	}
+
+	mes, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title:       "Confirm purge",
+			Description: fmt.Sprintf("This will delete **%v** %s from `%s`. A JSON backup will be exported first.", count, summary, collection),
+			Color:       accent,
+		},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Delete",
+						Style:    discordgo.DangerButton,
+						CustomID: "purge confirm",
+					},
+					discordgo.Button{
+						Label:    "Cancel",
+						Style:    discordgo.SecondaryButton,
+						CustomID: "purge cancel",
+					},
+				},
+			},
+		},
+		Reference: m.Reference(),
+	})
+	if err != nil {
+		return
+	}
+
+	pendingPurgesMutex.Lock()
+	for id, purge := range pendingPurges {
+		if time.Now().After(purge.expires) {
+			delete(pendingPurges, id)
+		}
+	}
+	pendingPurges[mes.ID] = pendingPurge{
+		userID:     m.Author.ID,
+		collection: collection,
+		filter:     filter,
+		summary:    summary,
+		expires:    time.Now().Add(purgeConfirmTimeout),
+	}
+	pendingPurgesMutex.Unlock()
+}
+
+// Writes every document matching a filter to a JSON file, one document per line.
+func backupDocuments(collection string, filter bson.M) (string, error) {
+	cur, err := db.Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return "", err
+	}
+	defer cur.Close(ctx)
+
+	var buf bytes.Buffer
+	for cur.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cur.Current, false, false)
+		if err != nil {
+			return "", err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := cur.Err(); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(backupDir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(backupDir, fmt.Sprintf("%s-%s.json", collection, time.Now().Format("20060102-150405")))
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+func purgeConfirmHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := interactionUserID(i)
+
+	pendingPurgesMutex.Lock()
+	purge, ok := pendingPurges[i.Message.ID]
+	if ok && purge.userID == userID {
+		delete(pendingPurges, i.Message.ID)
+	}
+	pendingPurgesMutex.Unlock()
+
+	if !ok {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "This purge has expired or was already handled, run the command again.",
+				// ephemeral
+				Flags: 1 << 6,
+			},
+		})
+		return
+	} else if purge.userID != userID {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Only the person who started this purge can confirm it.",
+				// ephemeral
+				Flags: 1 << 6,
+			},
+		})
+		return
+	}
+
+	respond := func(desc string) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Embeds: []*discordgo.MessageEmbed{
+					{
+						Title:       "Purge",
+						Description: desc,
+						Color:       accent,
+					},
+				},
+				Components: []discordgo.MessageComponent{},
+			},
+		})
+	}
+
+	if time.Now().After(purge.expires) {
+		respond("This confirmation has expired, run the command again.")
+		return
+	}
+	if strings.Split(i.MessageComponentData().CustomID, " ")[1] != "confirm" {
+		respond("Cancelled, nothing was deleted.")
+		return
+	}
+
+	// the backup and delete can take longer than Discord waits for an answer, so the press is acknowledged first and
+	// the message edited with the result
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	respond = func(desc string) {
+		_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			Embed: &discordgo.MessageEmbed{
+				Title:       "Purge",
+				Description: desc,
+				Color:       accent,
+			},
+			Components: []discordgo.MessageComponent{},
+			ID:         i.Message.ID,
+			Channel:    i.ChannelID,
+		})
+		if err != nil {
+			interactionLogger(i).WithError(err).Error("Failed to update purge message")
+		}
+	}
+
+	// documents created after this point aren't in the backup, so they mustn't be deleted either
+	filter := bson.M{"$and": bson.A{
+		purge.filter,
+		bson.M{"_id": bson.M{"$lt": primitive.NewObjectIDFromTimestamp(time.Now())}},
+	}}
+
+	path, err := backupDocuments(purge.collection, filter)
+	if err != nil {
+		respond(fmt.Sprintf("Failed to export a backup, nothing was deleted: %s", err.Error()))
+		return
+	}
+
+	res, err := db.Collection(purge.collection).DeleteMany(ctx, filter)
+	if err != nil {
+		respond(fmt.Sprintf("Failed to delete documents: %s\nA backup was saved to `%s`.", err.Error(), path))
+		return
+	}
+
+	interactionLogger(i).WithField("backup", path).Infof("Purged %v %s", res.DeletedCount, purge.summary)
+	respond(fmt.Sprintf("Deleted %v %s.\nA backup was saved to `%s`.", res.DeletedCount, purge.summary, path))
+
+	// backups can hold other servers' data, so they're only ever sent to the owner privately
+	if info, err := os.Stat(path); err == nil && info.Size() <= maxBackupUploadSize {
+		dm, err := s.UserChannelCreate(userID)
+		if err != nil {
+			return
+		}
+		if f, err := os.Open(path); err == nil {
+			defer f.Close()
+			s.ChannelFileSend(dm.ID, filepath.Base(path), f)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gocolly/colly"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/quakecodes/gopartpicker"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	commandInvocations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "partsbot_command_invocations_total",
+		Help: "Number of times each command has been run.",
+	}, []string{"command"})
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "partsbot_command_duration_seconds",
+		Help:    "How long command handlers take to finish.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"command"})
+	scrapes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "partsbot_scrapes_total",
+		Help: "Number of PCPartPicker and vendor requests by kind and result.",
+	}, []string{"kind", "result"})
+	scrapeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "partsbot_scrape_duration_seconds",
+		Help:    "How long PCPartPicker and vendor requests take.",
+		Buckets: []float64{0.25, 0.5, 1, 2, 4, 8, 16},
+	}, []string{"kind"})
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "partsbot_cache_lookups_total",
+		Help: "Number of cache lookups by cache and whether they hit.",
+	}, []string{"cache", "result"})
+	proxyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "partsbot_proxy_requests_total",
+		Help: "Number of requests sent through each proxy by result.",
+	}, []string{"proxy", "result"})
+	affiliateLinks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "partsbot_affiliate_links_total",
+		Help: "Number of vendor links rewritten by each affiliate.",
+	}, []string{"affiliate"})
+)
+
+// Records and logs a finished scrape. Redirects to a single search result count as successes.
+func observeScrape(logger *logrus.Entry, kind string, start time.Time, err error) {
+	took := time.Since(start)
+	logger = logger.WithFields(logrus.Fields{
+		"scrape":      kind,
+		"duration_ms": took.Milliseconds(),
+	})
+
+	var redirect *gopartpicker.RedirectError
+	result := "ok"
+	if err != nil && !errors.As(err, &redirect) {
+		result = "error"
+		logger.WithError(err).Warn("Scrape failed")
+	} else {
+		logger.Debug("Scrape finished")
+	}
+
+	recordScrape(result == "ok")
+	scrapes.WithLabelValues(kind, result).Inc()
+	scrapeDuration.WithLabelValues(kind).Observe(took.Seconds())
+}
+
+func observeCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// Counts the results of a collector's requests by the proxy they went through.
+func instrumentProxies(col *colly.Collector) {
+	observe := func(r *colly.Response, result string) {
+		if r == nil || r.Request == nil || r.Request.ProxyURL == "" {
+			return
+		}
+		// the host is used as the label so proxy credentials don't end up in metrics
+		proxy := r.Request.ProxyURL
+		if u, err := url.Parse(proxy); err == nil {
+			proxy = u.Host
+		}
+		proxyRequests.WithLabelValues(proxy, result).Inc()
+	}
+	col.OnResponse(func(r *colly.Response) {
+		observe(r, "ok")
+	})
+	col.OnError(func(r *colly.Response, _ error) {
+		observe(r, "error")
+	})
+}
+
+// Registers gauges that are read from the session and config when metrics are scraped.
+func registerSessionMetrics(s *discordgo.Session) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "partsbot_gateway_latency_seconds",
+		Help: "Latency of the last gateway heartbeat.",
+	}, func() float64 {
+		return s.HeartbeatLatency().Seconds()
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "partsbot_guilds",
+		Help: "Number of servers the bot is in.",
+	}, func() float64 {
+		s.State.RLock()
+		defer s.State.RUnlock()
+		return float64(len(s.State.Guilds))
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "partsbot_proxies",
+		Help: "Number of configured proxies.",
+	}, func() float64 {
+		return float64(len(conf().PCPartPicker.Proxies))
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "partsbot_part_views",
+		Help: "Number of part embeds with active buttons.",
+	}, func() float64 {
+		partViewsMutex.Lock()
+		defer partViewsMutex.Unlock()
+		return float64(len(partViews))
+	})
+}
+
+// Starts the Prometheus metrics endpoint.
+func startMetricsServer(s *discordgo.Session) {
+	registerSessionMetrics(s)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	log.WithField("address", conf().Metrics.Address).Info("Starting metrics endpoint")
+	server := &http.Server{
+		Addr:              conf().Metrics.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		log.WithError(err).Error("Metrics endpoint stopped")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A change to the stored documents, run once at startup on databases that haven't had it applied yet.
+type migration struct {
+	version     int
+	description string
+	run         func() error
+}
+
+// A migration that has been applied, stored in the migrations collection.
+type appliedMigration struct {
+	Version     int       `bson:"version"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Migrations in the order they're applied. Versions must be increasing, and a migration must never be changed or
+// removed once released, add a new one instead.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "add schema version, join date and inactive flag to guilds",
+		run: func() error {
+			_, err := db.Collection("guilds").UpdateMany(ctx, bson.M{
+				"schema_version": bson.M{"$exists": false},
+			}, []bson.M{
+				{"$set": bson.M{
+					"schema_version":       1,
+					"inactive":             bson.M{"$ifNull": []interface{}{"$inactive", false}},
+					"announcement_channel": bson.M{"$ifNull": []interface{}{"$announcement_channel", ""}},
+					"joined_at":            bson.M{"$ifNull": []interface{}{"$joined_at", time.Now()}},
+				}},
+			})
+			return err
+		},
+	},
+	{
+		version:     2,
+		description: "index guild, link, click and affiliate URL lookups",
+		run: func() error {
+			indexes := map[string]bson.D{
+				"guilds": {{Key: "id", Value: 1}},
+				"links":  {{Key: "id", Value: 1}},
+				"clicks": {{Key: "time", Value: 1}},
+				"urls":   {{Key: "id", Value: 1}, {Key: "affiliate", Value: 1}},
+			}
+			for col, keys := range indexes {
+				_, err := db.Collection(col).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys})
+				if err != nil {
+					return fmt.Errorf("%s: %w", col, err)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     3,
+		description: "move the price and specs settings to disabled commands",
+		run: func() error {
+			cur, err := db.Collection("guilds").Find(ctx, bson.M{
+				"disabled_commands": bson.M{"$exists": false},
+			})
+			if err != nil {
+				return err
+			}
+			var guilds []struct {
+				ID       interface{}   `bson:"_id"`
+				GuildID  string        `bson:"id"`
+				Settings bson.RawValue `bson:"settings"`
+			}
+			if err := cur.All(ctx, &guilds); err != nil {
+				return err
+			}
+
+			for _, g := range guilds {
+				disabled := []string{}
+				set := bson.M{
+					"schema_version":    2,
+					"disabled_channels": bson.M{},
+				}
+				// guilds without settings had the defaults, which had both commands on
+				if g.Settings.Type != 0 {
+					settings, err := migrationInt(g.Settings)
+					if err != nil {
+						return fmt.Errorf("guild %s: settings: %w", g.GuildID, err)
+					}
+					if settings&2 == 0 {
+						disabled = append(disabled, "price", "pricecompare")
+					}
+					if settings&4 == 0 {
+						disabled = append(disabled, "specs")
+					}
+					// stored back as a whole number without the old bits, which later updates with $bit need
+					set["settings"] = settings &^ (2 | 4)
+				}
+				set["disabled_commands"] = disabled
+				_, err := db.Collection("guilds").UpdateOne(ctx, bson.M{
+					"_id": g.ID,
+				}, bson.M{
+					"$set": set,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     4,
+		description: "turn on unknown command replies for existing guilds",
+		run: func() error {
+			// migration 3 stored every value as a whole number, $bit fails on anything else and creates missing ones
+			_, err := db.Collection("guilds").UpdateMany(ctx, bson.M{
+				"$or": bson.A{
+					bson.M{"settings": bson.M{"$type": bson.A{"int", "long"}}},
+					bson.M{"settings": bson.M{"$exists": false}},
+				},
+			}, bson.M{
+				"$bit": bson.M{"settings": bson.M{"or": 8}},
+			})
+			return err
+		},
+	},
+	{
+		version:     5,
+		description: "index user settings lookups",
+		run: func() error {
+			_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "id", Value: 1}},
+			})
+			return err
+		},
+	},
+	{
+		version:     6,
+		description: "remove affiliate URLs cached before they were keyed by affiliate and code",
+		run: func() error {
+			_, err := db.Collection("urls").DeleteMany(ctx, bson.M{
+				"$or": bson.A{
+					bson.M{"affiliate": bson.M{"$exists": false}},
+					bson.M{"code": bson.M{"$exists": false}},
+				},
+			})
+			return err
+		},
+	},
+	{
+		version:     7,
+		description: "make user settings lookups unique",
+		run: func() error {
+			users := db.Collection("users")
+
+			// keep one document per user in case concurrent first writes inserted several
+			cur, err := users.Aggregate(ctx, mongo.Pipeline{
+				{{Key: "$group", Value: bson.M{
+					"_id":   "$id",
+					"docs":  bson.M{"$push": "$_id"},
+					"count": bson.M{"$sum": 1},
+				}}},
+				{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+			})
+			if err != nil {
+				return err
+			}
+			var duplicates []struct {
+				Docs []interface{} `bson:"docs"`
+			}
+			if err := cur.All(ctx, &duplicates); err != nil {
+				return err
+			}
+			for _, dup := range duplicates {
+				_, err := users.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": dup.Docs[1:]}})
+				if err != nil {
+					return err
+				}
+			}
+
+			// the index from migration 5 has the same keys, so it has to go before the unique one can be made
+			if _, err := users.Indexes().DropOne(ctx, "id_1"); err != nil {
+				return err
+			}
+			_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			})
+			return err
+		},
+	},
+}
+
+// Reads a stored whole number, which can be any of BSON's number types depending on how it was last written.
+func migrationInt(v bson.RawValue) (int64, error) {
+	switch v.Type {
+	case bsontype.Int32:
+		return int64(v.Int32()), nil
+	case bsontype.Int64:
+		return v.Int64(), nil
+	case bsontype.Double:
+		f := v.Double()
+		if f != math.Trunc(f) {
+			return 0, fmt.Errorf("%v isn't a whole number", f)
+		}
+		return int64(f), nil
+	}
+	return 0, fmt.Errorf("unexpected type %s", v.Type)
+}
+
+// The version of the database schema this version of the bot expects.
+var schemaVersion = migrations[len(migrations)-1].version
+
+// Returns the version of the last migration applied to the database, 0 if none have been.
+func appliedSchemaVersion() (int, error) {
+	var last appliedMigration
+	err := db.Collection("migrations").FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"version": -1})).Decode(&last)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	return last.Version, err
+}
+
+// Applies every migration newer than the database's schema version in order, stopping at the first one that fails.
+func runMigrations() error {
+	current, err := appliedSchemaVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if current > schemaVersion {
+		return fmt.Errorf("database schema version %v is newer than this version of the bot supports (%v)", current, schemaVersion)
+	}
+
+	for _, mig := range migrations {
+		if mig.version <= current {
+			continue
+		}
+		log.WithField("version", mig.version).Infof("Applying migration: %s", mig.description)
+		if err := mig.run(); err != nil {
+			return fmt.Errorf("migration %v failed: %w", mig.version, err)
+		}
+		_, err := db.Collection("migrations").InsertOne(ctx, appliedMigration{
+			Version:     mig.version,
+			Description: mig.description,
+			AppliedAt:   time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record migration %v: %w", mig.version, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// An amount of money in hundredths of a currency's main unit.
+type money struct {
+	Amount   int64
+	Currency string
+}
+
+var (
+	errEmptyPrice   = errors.New("empty price")
+	errInvalidPrice = errors.New("invalid price")
+	// a symbol such as $ that's used by several currencies, given without a region that tells them apart
+	errAmbiguousCurrency = fmt.Errorf("%w: ambiguous currency", errInvalidPrice)
+
+	// currency symbols and abbreviations that aren't ISO codes
+	currencySymbols = map[string]string{
+		"£":   "GBP",
+		"€":   "EUR",
+		"us$": "USD",
+		"a$":  "AUD",
+		"au$": "AUD",
+		"c$":  "CAD",
+		"ca$": "CAD",
+		"nz$": "NZD",
+		"kč":  "CZK",
+		"ft":  "HUF",
+		"lei": "RON",
+		"zł":  "PLN",
+		"﷼":   "SAR",
+		"ر.س": "SAR",
+	}
+	// currencies used by each PCPartPicker region
+	regionCurrencies = map[string]string{
+		"us": "USD",
+		"uk": "GBP",
+		"ca": "CAD",
+		"au": "AUD",
+		"nz": "NZD",
+		"at": "EUR",
+		"be": "EUR",
+		"de": "EUR",
+		"es": "EUR",
+		"fi": "EUR",
+		"fr": "EUR",
+		"ie": "EUR",
+		"it": "EUR",
+		"nl": "EUR",
+		"pt": "EUR",
+		"sk": "EUR",
+		"cz": "CZK",
+		"dk": "DKK",
+		"hu": "HUF",
+		"no": "NOK",
+		"pl": "PLN",
+		"ro": "RON",
+		"sa": "SAR",
+		"se": "SEK",
+	}
+	// currencies with symbols that are shared between regions, e.g. $ or kr
+	ambiguousSymbols = map[string]map[string]string{
+		"$": {
+			"us": "USD",
+			"ca": "CAD",
+			"au": "AUD",
+			"nz": "NZD",
+		},
+		"kr": {
+			"se": "SEK",
+			"dk": "DKK",
+			"no": "NOK",
+		},
+	}
+)
+
+// Parses a PCPartPicker price string such as "$1,299.99", "1.299,99 €" or "5500 RON" into an amount and ISO currency
+// code. The region is used to tell apart currencies that share a symbol.
+func parsePrice(price string, region string) (money, error) {
+	price = strings.TrimSpace(price)
+	if price == "" {
+		return money{}, errEmptyPrice
+	}
+
+	negative := false
+	number := ""
+	symbol := ""
+
+	chars := []rune(price)
+	for i, char := range chars {
+		switch {
+		case unicode.IsDigit(char):
+			number += string(char)
+		case char == '.' || char == ',':
+			// separators are only part of the number between digits, e.g. "kr. 1.299,00" or "1.299,00 ر.س"
+			if number != "" && i+1 < len(chars) && unicode.IsDigit(chars[i+1]) {
+				number += string(char)
+			} else {
+				symbol += string(char)
+			}
+		case char == '-' || char == '−' || char == '+':
+			// a sign only counts before the number, so "1-2" isn't read as -12
+			if number != "" {
+				return money{}, errInvalidPrice
+			}
+			negative = negative || char != '+'
+		case unicode.IsSpace(char) || char == '\'':
+			continue
+		default:
+			symbol += string(char)
+		}
+	}
+
+	number = strings.TrimRight(number, ".,")
+	symbol = strings.Trim(symbol, ".,")
+	if number == "" {
+		return money{}, errInvalidPrice
+	}
+
+	amount, err := parseAmount(number)
+	if err != nil {
+		return money{}, err
+	}
+	if negative {
+		amount = -amount
+	}
+
+	currency, err := parseCurrency(symbol, region)
+	if err != nil {
+		return money{}, err
+	}
+
+	return money{
+		Amount:   amount,
+		Currency: currency,
+	}, nil
+}
+
+// Parses digits with any mix of thousands separators and decimal points/commas into hundredths.
+func parseAmount(number string) (int64, error) {
+	whole := number
+	fraction := ""
+
+	// the last separator is a decimal separator only if it's followed by one or two digits
+	if i := strings.LastIndexAny(number, ".,"); i != -1 && len(number)-i-1 <= 2 {
+		whole = number[:i]
+		fraction = number[i+1:]
+	}
+
+	whole = strings.NewReplacer(".", "", ",", "").Replace(whole)
+	if whole == "" {
+		whole = "0"
+	}
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, errInvalidPrice
+	}
+	cents, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil {
+		return 0, errInvalidPrice
+	}
+
+	// amounts too large to store in hundredths would wrap around to nonsense, possibly negative, values
+	if units > (math.MaxInt64-cents)/100 {
+		return 0, errInvalidPrice
+	}
+
+	return units*100 + cents, nil
+}
+
+func parseCurrency(symbol string, region string) (string, error) {
+	region = strings.ToLower(region)
+	lower := strings.ToLower(symbol)
+
+	if symbol == "" {
+		currency, ok := regionCurrencies[region]
+		if !ok {
+			return "", errInvalidPrice
+		}
+		return currency, nil
+	}
+	if currency, ok := currencySymbols[lower]; ok {
+		return currency, nil
+	}
+	if currencies, ok := ambiguousSymbols[lower]; ok {
+		if currency, ok := currencies[region]; ok {
+			return currency, nil
+		}
+		return "", fmt.Errorf("%w '%s'", errAmbiguousCurrency, symbol)
+	}
+	if len(symbol) == 3 && strings.ToUpper(symbol) == symbol {
+		return symbol, nil
+	}
+
+	return "", fmt.Errorf("%w: unknown currency '%s'", errInvalidPrice, symbol)
+}
+
+// Returns the amount as a float in the currency's main unit.
+func (m money) Float() float64 {
+	return float64(m.Amount) / 100
+}
+
+func (m money) String() string {
+	return fmt.Sprintf("%.2f %s", m.Float(), m.Currency)
+}
+
+// Gets the PCPartPicker region code for a PCPartPicker URL, e.g. "uk" for https://uk.pcpartpicker.com/...
+func regionFromURL(URL string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(URL, "https://"), "http://")
+	if i := strings.Index(host, "pcpartpicker.com"); i > 0 && host[i-1] == '.' {
+		return host[:i-1]
+	}
+	return "us"
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		price    string
+		region   string
+		amount   int64
+		currency string
+		err      error
+	}{
+		// separators
+		{"$1,299.99", "us", 129999, "USD", nil},
+		{"$1299.99", "us", 129999, "USD", nil},
+		{"$1,299", "us", 129900, "USD", nil},
+		{"$1,299,999.50", "us", 129999950, "USD", nil},
+		{"1.299,99 €", "de", 129999, "EUR", nil},
+		{"1.299 €", "de", 129900, "EUR", nil},
+		{"1 299,99 €", "fr", 129999, "EUR", nil},
+		{"1'299.99 €", "de", 129999, "EUR", nil},
+		{"€1,299.9", "ie", 129990, "EUR", nil},
+		{"5500 RON", "ro", 550000, "RON", nil},
+		{"-$5.00", "us", -500, "USD", nil},
+		{"+$5.00", "us", 500, "USD", nil},
+		{"$-5.00", "us", -500, "USD", nil},
+		{"$92233720368547758.07", "us", 9223372036854775807, "USD", nil},
+
+		// symbols before and after the number
+		{"kr. 1.299,00", "dk", 129900, "DKK", nil},
+		{"1.299,00 kr.", "dk", 129900, "DKK", nil},
+		{"1 299 kr", "se", 129900, "SEK", nil},
+		{"kr 1 299", "no", 129900, "NOK", nil},
+		{"ر.س 1,299.00", "sa", 129900, "SAR", nil},
+		{"1,299.00 ر.س", "sa", 129900, "SAR", nil},
+		{"1,299.00 ر.س.", "sa", 129900, "SAR", nil},
+		{"C$1,299.99", "", 129999, "CAD", nil},
+		{"1,299.99 C$", "", 129999, "CAD", nil},
+		{"$1,299.99", "ca", 129999, "CAD", nil},
+		{"$1,299.99", "au", 129999, "AUD", nil},
+		{"$1,299.99", "nz", 129999, "NZD", nil},
+		{"1299.99 USD", "uk", 129999, "USD", nil},
+		{"1299.99", "uk", 129999, "GBP", nil},
+
+		// invalid
+		{"", "us", 0, "", errEmptyPrice},
+		{"   ", "us", 0, "", errEmptyPrice},
+		{"$", "us", 0, "", errInvalidPrice},
+		{"free", "us", 0, "", errInvalidPrice},
+		{"1299.99", "", 0, "", errInvalidPrice},
+		{"1299.99 usd", "us", 0, "", errInvalidPrice},
+		{"1299.99 ABCD", "us", 0, "", errInvalidPrice},
+		{"99999999999999999999", "us", 0, "", errInvalidPrice},
+		{"99999999999999999", "us", 0, "", errInvalidPrice},
+		{"$92233720368547758.08", "us", 0, "", errInvalidPrice},
+		{"1-2", "us", 0, "", errInvalidPrice},
+		{"$5.00-", "us", 0, "", errInvalidPrice},
+		{"5+5", "us", 0, "", errInvalidPrice},
+		{"$1,299.99", "", 0, "", errAmbiguousCurrency},
+		{"$1,299.99", "uk", 0, "", errAmbiguousCurrency},
+		{"1 299 kr", "us", 0, "", errAmbiguousCurrency},
+	}
+
+	for _, test := range tests {
+		price, err := parsePrice(test.price, test.region)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("parsePrice(%q, %q) error = %v, want %v", test.price, test.region, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePrice(%q, %q) error = %v", test.price, test.region, err)
+			continue
+		}
+		if price.Amount != test.amount || price.Currency != test.currency {
+			t.Errorf("parsePrice(%q, %q) = %v, want %v", test.price, test.region, price, money{test.amount, test.currency})
+		}
+	}
+}
+
+func TestParsePriceSymbols(t *testing.T) {
+	for symbol, currency := range currencySymbols {
+		for _, price := range []string{symbol + "1,299.99", symbol + " 1,299.99", "1,299.99" + symbol, "1,299.99 " + symbol} {
+			got, err := parsePrice(price, "")
+			if err != nil || got.Amount != 129999 || got.Currency != currency {
+				t.Errorf("parsePrice(%q) = %v, %v, want %s", price, got, err, currency)
+			}
+		}
+	}
+}
+
+func TestParsePriceRegions(t *testing.T) {
+	for region, currency := range regionCurrencies {
+		got, err := parsePrice("1,299.99", region)
+		if err != nil || got.Amount != 129999 || got.Currency != currency {
+			t.Errorf("parsePrice(%q, %q) = %v, %v, want %s", "1,299.99", region, got, err, currency)
+		}
+	}
+
+	for symbol, currencies := range ambiguousSymbols {
+		for region, currency := range currencies {
+			got, err := parsePrice(symbol+"1,299.99", region)
+			if err != nil || got.Currency != currency {
+				t.Errorf("parsePrice(%q, %q) = %v, %v, want %s", symbol+"1,299.99", region, got, err, currency)
+			}
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		number string
+		amount int64
+		err    bool
+	}{
+		{"0", 0, false},
+		{"5", 500, false},
+		{"5.5", 550, false},
+		{"5,50", 550, false},
+		{"1.299", 129900, false},
+		{"1,299", 129900, false},
+		{"1.299,99", 129999, false},
+		{"1,299.99", 129999, false},
+		{"1.299.999", 129999900, false},
+		{",99", 99, false},
+		{"", 0, false},
+		{"1.2.3a", 0, true},
+		{"abc", 0, true},
+		{"99999999999999999", 0, true},
+		{"92233720368547758.07", 9223372036854775807, false},
+		{"92233720368547758.08", 0, true},
+	}
+
+	for _, test := range tests {
+		amount, err := parseAmount(test.number)
+		if (err != nil) != test.err {
+			t.Errorf("parseAmount(%q) error = %v, want error %v", test.number, err, test.err)
+			continue
+		}
+		if !test.err && amount != test.amount {
+			t.Errorf("parseAmount(%q) = %v, want %v", test.number, amount, test.amount)
+		}
+	}
+}
+
+func TestParseCurrency(t *testing.T) {
+	tests := []struct {
+		symbol   string
+		region   string
+		currency string
+		err      error
+	}{
+		{"", "uk", "GBP", nil},
+		{"", "pl", "PLN", nil},
+		{"£", "us", "GBP", nil},
+		{"ZŁ", "", "PLN", nil},
+		{"Kč", "", "CZK", nil},
+		{"$", "CA", "CAD", nil},
+		{"kr", "se", "SEK", nil},
+		{"CHF", "", "CHF", nil},
+		{"", "", "", errInvalidPrice},
+		{"", "xx", "", errInvalidPrice},
+		{"$", "", "", errAmbiguousCurrency},
+		{"$", "uk", "", errAmbiguousCurrency},
+		{"kr", "us", "", errAmbiguousCurrency},
+		{"chf", "", "", errInvalidPrice},
+		{"bucks", "", "", errInvalidPrice},
+	}
+
+	for _, test := range tests {
+		currency, err := parseCurrency(test.symbol, test.region)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("parseCurrency(%q, %q) error = %v, want %v", test.symbol, test.region, err, test.err)
+			}
+			continue
+		}
+		if err != nil || currency != test.currency {
+			t.Errorf("parseCurrency(%q, %q) = %q, %v, want %q", test.symbol, test.region, currency, err, test.currency)
+		}
+	}
+}
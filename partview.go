@@ -0,0 +1,489 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/quakecodes/gopartpicker"
+)
+
+const (
+	vendorsPerPage   = 10
+	partViewLifetime = 15 * time.Minute
+)
+
+type vendorLine struct {
+	line    string
+	inStock bool
+}
+
+// The state of a part embed that can be switched between views and navigated with buttons.
+type partView struct {
+	URL         string
+	guildID     string
+	requestID   string
+	part        *gopartpicker.Part
+	mode        string
+	vendors     []vendorLine
+	vendorsOnce sync.Once
+	page        int
+	inStockOnly bool
+	image       int
+}
+
+var (
+	partViewLabels = map[string]string{
+		"price":  "Price",
+		"specs":  "Specs",
+		"images": "Images",
+	}
+	partViews      = map[string]*partView{}
+	partViewsMutex sync.Mutex
+)
+
+func init() {
+	router.addSubhandler(3, "partview", partViewHandler)
+	router.addSubhandler(3, "vendorpage", vendorPageHandler)
+	router.addSubhandler(3, "imagepage", imagePageHandler)
+}
+
+// Creates a view for a part showing either its price or specs.
+func newPartView(URL string, part *gopartpicker.Part, mode string, guildID string, requestID string) *partView {
+	return &partView{
+		URL:       URL,
+		guildID:   guildID,
+		requestID: requestID,
+		part:      part,
+		mode:      mode,
+	}
+}
+
+// Stores the view for a message and disables its buttons once the view expires.
+func storePartView(s *discordgo.Session, m *discordgo.Message, v *partView) {
+	partViewsMutex.Lock()
+	partViews[m.ID] = v
+	partViewsMutex.Unlock()
+
+	time.AfterFunc(partViewLifetime, func() {
+		defer recoverWorker(log.WithField("request_id", v.requestID), "part view expiry", nil)
+
+		partViewsMutex.Lock()
+		delete(partViews, m.ID)
+		mode := v.mode
+		partViewsMutex.Unlock()
+
+		if mode == "price" {
+			v.loadVendors()
+		}
+
+		var embed *discordgo.MessageEmbed
+		var components []discordgo.MessageComponent
+		withPartViews(func() {
+			embed = v.embed()
+			components = disableComponents(v.components())
+		})
+
+		s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			Embed:      embed,
+			Components: components,
+			ID:         m.ID,
+			Channel:    m.ChannelID,
+		})
+	})
+}
+
+// Runs a function with the part views locked, unlocking them even if it panics so one bad view can't block the rest.
+func withPartViews(f func()) {
+	partViewsMutex.Lock()
+	defer partViewsMutex.Unlock()
+	f()
+}
+
+func getPartView(messageID string) *partView {
+	partViewsMutex.Lock()
+	defer partViewsMutex.Unlock()
+
+	v, ok := partViews[messageID]
+	observeCacheLookup("part_views", ok)
+	return v
+}
+
+// Returns a copy of action rows with all of their buttons disabled.
+func disableComponents(components []discordgo.MessageComponent) []discordgo.MessageComponent {
+	disabled := []discordgo.MessageComponent{}
+	for _, comp := range components {
+		row, ok := comp.(discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		newRow := discordgo.ActionsRow{}
+		for _, rowComp := range row.Components {
+			if button, ok := rowComp.(discordgo.Button); ok {
+				button.Disabled = true
+				rowComp = button
+			}
+			newRow.Components = append(newRow.Components, rowComp)
+		}
+		disabled = append(disabled, newRow)
+	}
+	return disabled
+}
+
+// Resolves vendor links, sorted by price with affiliate links applied. This only scrapes on the first call, and has to
+// be called before the price view is shown. It can be slow, so don't hold partViewsMutex while calling it.
+func (v *partView) loadVendors() {
+	v.vendorsOnce.Do(func() {
+		vendors := sortVendors(v.part.Vendors, regionFromURL(v.URL))
+		sources := make([]linkSource, len(vendors))
+		for i := range sources {
+			sources[i] = linkSource{GuildID: v.guildID, PartURL: v.URL, RequestID: v.requestID}
+		}
+		links := resolveVendorLinks(vendors, sources)
+		for i, vendor := range vendors {
+			link := links[i]
+			v.vendors = append(v.vendors, vendorLine{
+				line:    fmt.Sprintf("[%s](%s): %s", vendor.Name, link.URL, vendor.Price.TotalString),
+				inStock: vendor.InStock,
+			})
+		}
+	})
+}
+
+func (v *partView) embed() *discordgo.MessageEmbed {
+	switch v.mode {
+	case "specs":
+		return v.specsEmbed()
+	case "images":
+		return v.imagesEmbed()
+	default:
+		return v.priceEmbed()
+	}
+}
+
+func (v *partView) components() []discordgo.MessageComponent {
+	buttons := []discordgo.MessageComponent{}
+	for _, mode := range []string{"price", "specs", "images"} {
+		style := discordgo.SecondaryButton
+		if mode == v.mode {
+			style = discordgo.PrimaryButton
+		}
+		buttons = append(buttons, discordgo.Button{
+			Label:    partViewLabels[mode],
+			Style:    style,
+			CustomID: "partView " + mode,
+			Disabled: mode == v.mode || (mode == "images" && len(v.part.Images) == 0),
+		})
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: buttons,
+		},
+	}
+
+	switch v.mode {
+	case "price":
+		components = append(components, v.priceComponents()...)
+	case "images":
+		components = append(components, v.imagesComponents()...)
+	}
+
+	return components
+}
+
+// Gets the vendors shown by the view, in-stock vendors first.
+func (v *partView) shownVendors() []vendorLine {
+	inStock := []vendorLine{}
+	notInStock := []vendorLine{}
+	for _, vendor := range v.vendors {
+		if vendor.inStock {
+			inStock = append(inStock, vendor)
+		} else if !v.inStockOnly {
+			notInStock = append(notInStock, vendor)
+		}
+	}
+	return append(inStock, notInStock...)
+}
+
+func (v *partView) pageCount() int {
+	count := (len(v.shownVendors()) + vendorsPerPage - 1) / vendorsPerPage
+	if count < 1 {
+		return 1
+	}
+	return count
+}
+
+func (v *partView) priceEmbed() *discordgo.MessageEmbed {
+	shown := v.shownVendors()
+
+	var desc string
+	if len(v.vendors) == 0 {
+		desc = "No pricing available."
+	} else if len(shown) == 0 {
+		desc = "Not in stock at any retailers."
+	} else {
+		desc = fmt.Sprintf("Available at %v retailer(s):", len(shown))
+	}
+
+	start := v.page * vendorsPerPage
+	end := start + vendorsPerPage
+	if end > len(shown) {
+		end = len(shown)
+	}
+
+	inStock := []string{}
+	notInStock := []string{}
+	for _, vendor := range shown[start:end] {
+		if vendor.inStock {
+			inStock = append(inStock, vendor.line)
+		} else {
+			notInStock = append(notInStock, vendor.line)
+		}
+	}
+
+	fields := []*discordgo.MessageEmbedField{}
+
+	if len(inStock) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "In stock",
+			Value: strings.Join(inStock, "\n"),
+		})
+	}
+	if len(notInStock) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Out of stock",
+			Value: strings.Join(notInStock, "\n"),
+		})
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Pricing for '%s':", v.part.Name),
+		URL:         v.URL,
+		Color:       accent,
+		Description: desc,
+		Fields:      fields,
+	}
+
+	if v.pageCount() > 1 {
+		embed.Footer = &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Page %v/%v", v.page+1, v.pageCount()),
+		}
+	}
+
+	if len(v.part.Images) > 0 {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{
+			URL: v.part.Images[0],
+		}
+	}
+
+	return embed
+}
+
+func (v *partView) priceComponents() []discordgo.MessageComponent {
+	if len(v.vendors) == 0 {
+		return []discordgo.MessageComponent{}
+	}
+
+	stockLabel := "In stock only"
+	if v.inStockOnly {
+		stockLabel = "Show all"
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Previous",
+					Style:    discordgo.SecondaryButton,
+					CustomID: "vendorPage prev",
+					Disabled: v.page == 0,
+				},
+				discordgo.Button{
+					Label:    "Next",
+					Style:    discordgo.SecondaryButton,
+					CustomID: "vendorPage next",
+					Disabled: v.page >= v.pageCount()-1,
+				},
+				discordgo.Button{
+					Label:    stockLabel,
+					Style:    discordgo.SecondaryButton,
+					CustomID: "vendorPage stock",
+				},
+			},
+		},
+	}
+}
+
+func (v *partView) specsEmbed() *discordgo.MessageEmbed {
+	desc := ""
+
+	if len(v.part.Specs) > 0 {
+		for _, spec := range v.part.Specs {
+			desc += fmt.Sprintf("**%s**: %s\n", spec.Name, strings.Join(spec.Values, ", "))
+		}
+	} else {
+		desc = "No specs available."
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Specs for '%s':", v.part.Name),
+		URL:         v.URL,
+		Color:       accent,
+		Description: desc,
+	}
+
+	if len(v.part.Images) > 0 {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{
+			URL: v.part.Images[0],
+		}
+	}
+
+	return embed
+}
+
+func (v *partView) imagesEmbed() *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Images for '%s':", v.part.Name),
+		URL:   v.URL,
+		Color: accent,
+	}
+
+	if len(v.part.Images) > 0 {
+		embed.Image = &discordgo.MessageEmbedImage{
+			URL: v.part.Images[v.image],
+		}
+		embed.Footer = &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Image %v/%v", v.image+1, len(v.part.Images)),
+		}
+	} else {
+		embed.Description = "No images available."
+	}
+
+	return embed
+}
+
+func (v *partView) imagesComponents() []discordgo.MessageComponent {
+	if len(v.part.Images) < 2 {
+		return []discordgo.MessageComponent{}
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Previous",
+					Style:    discordgo.SecondaryButton,
+					CustomID: "imagePage prev",
+				},
+				discordgo.Button{
+					Label:    "Next",
+					Style:    discordgo.SecondaryButton,
+					CustomID: "imagePage next",
+				},
+			},
+		},
+	}
+}
+
+// Updates a message with the new state of its view in response to a button press.
+func updatePartView(s *discordgo.Session, i *discordgo.InteractionCreate, update func(v *partView)) {
+	v := getPartView(i.Message.ID)
+	if v == nil {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Embeds:     i.Message.Embeds,
+				Components: disableComponents(i.Message.Components),
+			},
+		})
+		return
+	}
+
+	partViewsMutex.Lock()
+	showsPrice := v.mode == "price" || strings.HasSuffix(i.MessageComponentData().CustomID, "price")
+	partViewsMutex.Unlock()
+
+	// resolving vendors can take longer than Discord waits for a response, so acknowledge the press first and edit
+	// the message once they're loaded, without holding the lock
+	if showsPrice {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredMessageUpdate,
+		})
+		v.loadVendors()
+	}
+
+	var embed *discordgo.MessageEmbed
+	var components []discordgo.MessageComponent
+	withPartViews(func() {
+		update(v)
+		embed = v.embed()
+		components = v.components()
+	})
+
+	if showsPrice {
+		_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			Embed:      embed,
+			Components: components,
+			ID:         i.Message.ID,
+			Channel:    i.ChannelID,
+		})
+		if err != nil {
+			interactionLogger(i).WithError(err).Error("Failed to update part view")
+		}
+		return
+	}
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+}
+
+func partViewHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	mode := strings.Split(i.MessageComponentData().CustomID, " ")[1]
+	updatePartView(s, i, func(v *partView) {
+		v.mode = mode
+	})
+}
+
+func vendorPageHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action := strings.Split(i.MessageComponentData().CustomID, " ")[1]
+	updatePartView(s, i, func(v *partView) {
+		switch action {
+		case "prev":
+			if v.page > 0 {
+				v.page--
+			}
+		case "next":
+			if v.page < v.pageCount()-1 {
+				v.page++
+			}
+		case "stock":
+			v.inStockOnly = !v.inStockOnly
+			v.page = 0
+		}
+	})
+}
+
+func imagePageHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action := strings.Split(i.MessageComponentData().CustomID, " ")[1]
+	updatePartView(s, i, func(v *partView) {
+		count := len(v.part.Images)
+		if count == 0 {
+			return
+		}
+		// the gallery wraps around in both directions
+		switch action {
+		case "prev":
+			v.image = (v.image - 1 + count) % count
+		case "next":
+			v.image = (v.image + 1) % count
+		}
+	})
+}
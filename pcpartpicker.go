@@ -1,18 +1,21 @@
 package main
 
 import (
-	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/dlclark/regexp2"
 	"github.com/gocolly/colly"
 	collyProxy "github.com/gocolly/colly/proxy"
 	"github.com/quakecodes/gopartpicker"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type region struct {
@@ -21,62 +24,32 @@ type region struct {
 }
 
 var (
-	scraper           = gopartpicker.NewScraper()
-	productURLRegexp  = regexp2.MustCompile(`([a-z]{2}\.)?(pcpartpicker|partpicker).com\/product\/[a-zA-Z0-9]{4,8}\/`, 0)
-	affiliateIDRegexp = regexp2.MustCompile(`(?<=\/mr\/)[a-zA-Z]*\/[a-zA-Z0-9]{4,8}`, 0)
-	regions           = []region{}
+	scraper          gopartpicker.Scraper
+	proxySwitcher    atomic.Value
+	productURLRegexp = regexp2.MustCompile(`([a-z]{2}\.)?(pcpartpicker|partpicker).com\/product\/[a-zA-Z0-9]{4,8}\/`, 0)
+	regions          = []region{}
 )
 
 func init() {
-	scraper.SetHeaders("global", map[string]string{
-		"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/93.0.4577.82 Safari/537.36",
-		"accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.9",
-		"accept-encoding":           "gzip, deflate, br",
-		"accept-language":           "en-GB,en-US;q=0.9,en;q=0.8",
-		"cache-control":             "no-cache",
-		"pragma":                    "no-cache",
-		"sec-fetch-dest":            "document",
-		"sec-fetch-mode":            "navigate",
-		"sec-fetch-site":            "none",
-		"sec-fetch-user":            "1",
-		"sec-gpc":                   "1",
-		"upgrade-insecure-requests": "1",
-	})
-	if len(conf.PCPartPicker.Proxies) > 0 {
-		proxyAddrs := []string{}
-		for k := range conf.PCPartPicker.Proxies {
-			proxyAddrs = append(proxyAddrs, k)
-		}
-		switcher, err := collyProxy.RoundRobinProxySwitcher(proxyAddrs...)
-		if err != nil {
-			log.Printf("Failed to start proxy rotation: %s", err.Error())
-		}
-		scraper.Collector.SetProxyFunc(switcher)
-		// scraper.Collector.OnRequest(func(r *colly.Request) {
-		// 	proxy, ok := conf.PCPartPicker.Proxies[r.ProxyURL]
-		// 	if !ok {
-		// 		return
-		// 	}
-		// 	r.Headers.Set("")
-		// })
-	}
-	regions = getRegions()
-
 	router.addCommand(
 		command{
 			name:        "Price",
-			description: "Fetches pricing information for a part.",
-			args:        []string{"<partName>"},
+			description: "Fetches pricing information for a part. The region can be given before the part's name or with --region, --max limits the number of search results and --under hides results over a price.",
+			args:        []string{"<partName>", "[--region:region]", "[--max:int]", "[--under:price]"},
 			handler:     priceCommand,
+			category:    "Parts",
+			examples:    []string{"price rtx 3080", "price uk ryzen 5 5600x", "price \"b550 tomahawk\" --region ca --max 5 --under 200"},
 			aliases:     []string{"partprice", "pricepart"},
 		},
 	)
 	router.addCommand(
 		command{
 			name:        "Specs",
-			description: "Fetches specifications for a part.",
-			args:        []string{"<partName>"},
+			description: "Fetches specifications for a part. --max limits the number of search results.",
+			args:        []string{"<partName>", "[--max:int]"},
 			handler:     specsCommand,
+			category:    "Parts",
+			examples:    []string{"specs rtx 3080", "specs i5 12600k --max 5"},
 			aliases:     []string{"partspecs", "specspart"},
 		},
 	)
@@ -87,18 +60,92 @@ func init() {
 			name:        "Regions",
 			description: "Shows all available PCPartPicker regions.",
 			handler:     regionsCommand,
+			category:    "Parts",
+			examples:    []string{"regions"},
 			aliases:     []string{"region"},
 		},
 	)
 }
 
-func extractBaseProductURL(URL string) string {
-	match, _ := productURLRegexp.FindStringMatch(URL)
-	return match.String()
+// Sets up proxy rotation and the shared scraper, and fetches the available regions. This needs the config to be
+// loaded first.
+func setupScraper() {
+	setProxies(conf().PCPartPicker.Proxies)
+	// scraper.Collector.OnRequest(func(r *colly.Request) {
+	// 	proxy, ok := conf().PCPartPicker.Proxies[r.ProxyURL]
+	// 	if !ok {
+	// 		return
+	// 	}
+	// 	r.Headers.Set("")
+	// })
+	scraper = newScraper()
+	regions = getRegions()
+}
+
+// Replaces the pool of proxies requests are rotated between. Scrapers pick up the new pool on their next request.
+func setProxies(proxies map[string]proxy) {
+	if len(proxies) == 0 {
+		proxySwitcher.Store(colly.ProxyFunc(nil))
+		return
+	}
+
+	proxyAddrs := []string{}
+	for k := range proxies {
+		proxyAddrs = append(proxyAddrs, k)
+	}
+	switcher, err := collyProxy.RoundRobinProxySwitcher(proxyAddrs...)
+	if err != nil {
+		log.WithError(err).Error("Failed to start proxy rotation")
+		return
+	}
+	proxySwitcher.Store(switcher)
+}
+
+// Picks the proxy for a request from the current proxy pool, or no proxy if the pool is empty.
+func rotateProxy(r *http.Request) (*url.URL, error) {
+	switcher, _ := proxySwitcher.Load().(colly.ProxyFunc)
+	if switcher == nil {
+		return nil, nil
+	}
+	return switcher(r)
 }
 
-func extractAffiliateID(URL string) string {
-	match, _ := affiliateIDRegexp.FindStringMatch(URL)
+// The transport every scraper sends its requests through. It's shared so that scrapers made for a single lookup reuse
+// connections instead of each leaving their own idle ones open.
+var scraperTransport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = rotateProxy
+	return t
+}()
+
+// Creates a scraper with the bot's headers and proxy rotation applied. Each
+// scraper has its own collector, so separate scrapers can be used concurrently.
+func newScraper() gopartpicker.Scraper {
+	sc := gopartpicker.NewScraper()
+	sc.SetHeaders("global", map[string]string{
+		"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/93.0.4577.82 Safari/537.36",
+		"accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.9",
+		"accept-encoding":           "gzip, deflate, br",
+		"accept-language":           "en-GB,en-US;q=0.9,en;q=0.8",
+		"cache-control":             "no-cache",
+		"pragma":                    "no-cache",
+		"sec-fetch-dest":            "document",
+		"sec-fetch-mode":            "navigate",
+		"sec-fetch-site":            "none",
+		"sec-fetch-user":            "1",
+		"sec-gpc":                   "1",
+		"upgrade-insecure-requests": "1",
+	})
+	sc.Collector.WithTransport(scraperTransport)
+	instrumentProxies(sc.Collector)
+	return sc
+}
+
+func extractBaseProductURL(URL string) string {
+	match, _ := productURLRegexp.FindStringMatch(URL)
+	if match == nil {
+		return ""
+	}
 	return match.String()
 }
 
@@ -112,41 +159,32 @@ func incRequests(guildID string) {
 	})
 }
 
-func getAffiliate(vendor gopartpicker.Vendor, aff affiliate) string {
-	var doc bson.M
-	urlId := extractAffiliateID(vendor.URL)
-	res := db.Collection("urls").FindOne(ctx, bson.M{
-		"id": urlId,
-	})
-	res.Decode(&doc)
-	noDocuments := mongo.ErrNoDocuments
-	if !errors.As(res.Err(), &noDocuments) {
-		return strings.ReplaceAll(doc["url"].(string), "{{}}", aff.Code)
+// Sorts vendors by total price, cheapest first. Vendors with prices that can't be parsed keep their page order after
+// all priced vendors.
+func sortVendors(vendors []gopartpicker.Vendor, region string) []gopartpicker.Vendor {
+	prices := make(map[int]money, len(vendors))
+	order := make([]int, len(vendors))
+	for i, vendor := range vendors {
+		order[i] = i
+		if price, err := parsePrice(vendor.Price.TotalString, region); err == nil {
+			prices[i] = price
+		}
 	}
 
-	var redirectURL string
-
-	scraper.Collector.OnResponse(func(r *colly.Response) {
-		redirectURL = r.Request.URL.String()
+	sort.SliceStable(order, func(a, b int) bool {
+		priceA, okA := prices[order[a]]
+		priceB, okB := prices[order[b]]
+		if okA != okB {
+			return okA
+		}
+		return okA && priceA.Amount < priceB.Amount
 	})
 
-	err := scraper.Collector.Visit(vendor.URL)
-	scraper.Collector.Wait()
-
-	if err != nil {
-		log.Printf("Failed to convert affiliate link: %s\n", vendor.URL)
-		return vendor.URL
+	sorted := make([]gopartpicker.Vendor, len(vendors))
+	for i, idx := range order {
+		sorted[i] = vendors[idx]
 	}
-
-	baseURL, _ := regexp2.MustCompile(aff.FullRegexp, 0).FindStringMatch(redirectURL)
-	url := fmt.Sprintf("%s?%s", baseURL.String(), aff.Code)
-
-	db.Collection("urls").InsertOne(ctx, bson.M{
-		"id":  urlId,
-		"url": url,
-	})
-
-	return url
+	return sorted
 }
 
 func getRegions() []region {
@@ -164,8 +202,10 @@ func getRegions() []region {
 		})
 	})
 
-	scraper.Collector.Visit("https://pcpartpicker.com/")
+	start := time.Now()
+	err := scraper.Collector.Visit("https://pcpartpicker.com/")
 	scraper.Collector.Wait()
+	observeScrape(logrus.NewEntry(log), "regions", start, err)
 
 	return regions
 }
@@ -180,124 +220,48 @@ func displayPart(infoType string, URL string, s *discordgo.Session, m *discordgo
 		Channel: m.ChannelID,
 	})
 
+	logger := requestLogger(m).WithField("part", URL)
 	incRequests(m.GuildID)
+	start := time.Now()
 	part, err := scraper.GetPart(URL)
+	observeScrape(logger, "part", start, err)
 	if err != nil {
-		fmt.Printf("Failed to fetch part: %s\n", URL)
 		return
 	}
 
-	desc := ""
-
-	switch infoType {
-	case "price":
-		inStock := []string{}
-		notInStock := []string{}
-
-		if !(len(part.Vendors) > 0) {
-			desc = "No pricing available."
-		} else {
-			desc = fmt.Sprintf("Available at %v retailer(s):", len(part.Vendors))
-			for _, vendor := range part.Vendors {
-				vendorURL := vendor.URL
-				for _, aff := range conf.PCPartPicker.Affiliates {
-					if strings.Contains(strings.ToLower(vendor.Name), aff.Name) {
-						vendorURL = getAffiliate(vendor, aff)
-					}
-				}
-				line := fmt.Sprintf("[%s](%s): %s", vendor.Name, vendorURL, vendor.Price.TotalString)
-				if vendor.InStock {
-					inStock = append(inStock, line)
-				} else {
-					notInStock = append(notInStock, line)
-				}
-			}
-		}
-
-		fields := []*discordgo.MessageEmbedField{}
-
-		if len(inStock) > 0 {
-			if len(inStock) > 10 {
-				inStock = append(inStock[:10], fmt.Sprintf("*+%v more...*", len(inStock)-10))
-			}
-			fields = append(fields, &discordgo.MessageEmbedField{
-				Name:  "In stock",
-				Value: strings.Join(inStock, "\n"),
-			})
-		}
-		if len(notInStock) > 0 {
-			if len(notInStock) > 10 {
-				notInStock = append(notInStock[:10], fmt.Sprintf("*+%v more...*", len(notInStock)-10))
-			}
-			fields = append(fields, &discordgo.MessageEmbedField{
-				Name:  "Out of stock",
-				Value: strings.Join(notInStock, "\n"),
-			})
-		}
-
-		embed := &discordgo.MessageEmbed{
-			Title:       fmt.Sprintf("Pricing for '%s':", part.Name),
-			URL:         URL,
-			Color:       accent,
-			Description: desc,
-			Fields:      fields,
-		}
-
-		if len(part.Images) > 0 {
-			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{
-				URL: part.Images[0],
-			}
-		}
+	v := newPartView(URL, part, infoType, m.GuildID, requestID(m))
+	if infoType == "price" {
+		v.loadVendors()
+	}
+	storePartView(s, m, v)
 
-		s.ChannelMessageEditComplex(&discordgo.MessageEdit{
-			Embed:   embed,
-			ID:      m.ID,
-			Channel: m.ChannelID,
-		})
-	case "specs":
-		if len(part.Specs) > 0 {
-			for _, spec := range part.Specs {
-				desc += fmt.Sprintf("**%s**: %s\n", spec.Name, strings.Join(spec.Values, ", "))
-			}
-		} else {
-			desc = "No specs available."
-		}
+	_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Embed:      v.embed(),
+		Components: v.components(),
+		ID:         m.ID,
+		Channel:    m.ChannelID,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to show part")
+	}
+}
 
-		embed := &discordgo.MessageEmbed{
-			Title:       fmt.Sprintf("Specs for '%s':", part.Name),
-			URL:         URL,
-			Color:       accent,
-			Description: desc,
-		}
+func priceCommand(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+	partName := args.String("partName")
+	region := args.String("region")
 
-		if len(part.Images) > 0 {
-			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{
-				URL: part.Images[0],
+	if region == "" {
+		for _, reg := range regions {
+			split := strings.Split(partName, " ")
+			if len(split) > 1 && reg.code == strings.ToLower(split[0]) {
+				partName = strings.Join(split[1:], " ")
+				region = strings.ToLower(split[0])
 			}
 		}
-
-		s.ChannelMessageEditComplex(&discordgo.MessageEdit{
-			Embed:   embed,
-			ID:      m.ID,
-			Channel: m.ChannelID,
-		})
-	}
-}
-
-func priceCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-	g := getGuildState(m.GuildID)
-	if g.Settings&settingFlags["price"] == 0 {
-		return
 	}
-
-	partName := args[0]
-	region := ""
-
-	for _, reg := range regions {
-		split := strings.Split(args[0], " ")
-		if reg.code == strings.ToLower(split[0]) {
-			partName = strings.Join(split[1:], " ")
-			region = strings.ToLower(split[0])
+	if region == "" {
+		if u, err := getUserSettings(m.Author.ID); err == nil {
+			region = u.Region
 		}
 	}
 
@@ -310,7 +274,13 @@ func priceCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []strin
 	})
 
 	incRequests(m.GuildID)
+	start := time.Now()
 	parts, err := scraper.SearchParts(partName, region)
+	observeScrape(requestLogger(m.Message), "search", start, err)
+	if args.Has("under") {
+		parts = filterPartsUnder(parts, args.Money("under"), region)
+	}
+	parts = limitResults(parts, args)
 	if region == "" {
 		region = "US"
 	} else {
@@ -326,7 +296,7 @@ func priceCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []strin
 		return
 	} else if len(parts) == 0 {
 		s.ChannelMessageEditEmbed(mes.ChannelID, mes.ID, &discordgo.MessageEmbed{
-			Title: fmt.Sprintf("Couldn't find part '%s'", args[0]),
+			Title: fmt.Sprintf("Couldn't find part '%s'", partName),
 			Color: accent,
 		})
 		return
@@ -334,70 +304,27 @@ func priceCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []strin
 		displayPart("price", parts[0].URL, s, mes)
 		return
 	}
-	menuOptions := []discordgo.SelectMenuOption{}
-
-	if len(parts) > 20 {
-		parts = parts[:20]
-	}
-
-	for _, part := range parts {
-		var price string
-		if !part.Vendor.InStock || len(part.Vendor.Price.TotalString) == 0 {
-			price = "Out of stock."
-		} else {
-			price = part.Vendor.Price.TotalString
-		}
-
-		menuOptions = append(menuOptions, discordgo.SelectMenuOption{
-			Label:       part.Name,
-			Description: price,
-			Value:       extractBaseProductURL(part.URL),
-		})
-	}
-
-	menuOptions = append([]discordgo.SelectMenuOption{
-		{
-			Label: "Cancel",
-			Value: "cancel",
-			Emoji: discordgo.ComponentEmoji{
-				Name: "❌",
-			},
-		},
-	}, menuOptions...)
-
 	_, editErr := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
 		Embed: &discordgo.MessageEmbed{
 			Title: fmt.Sprintf("Search results for '%s' in %s:", partName, region),
 			Color: accent,
 		},
-		Components: []discordgo.MessageComponent{
-			discordgo.ActionsRow{
-				Components: []discordgo.MessageComponent{
-					discordgo.SelectMenu{
-						CustomID: "partSelect price",
-						Options:  menuOptions,
-					},
-				},
-			},
-		},
-		ID:      mes.ID,
-		Channel: m.ChannelID,
+		Components: partSelectMenu(parts, "price"),
+		ID:         mes.ID,
+		Channel:    m.ChannelID,
 	})
 
 	if editErr != nil {
-		fmt.Println(editErr)
+		requestLogger(m.Message).WithError(editErr).Error("Failed to show search results")
 	}
 }
 
-func specsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-	g := getGuildState(m.GuildID)
-	if g.Settings&settingFlags["specs"] == 0 {
-		return
-	}
+func specsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+	partName := args.String("partName")
 
 	mes, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
 		Embed: &discordgo.MessageEmbed{
-			Title: fmt.Sprintf("Searching for '%s'...", args[0]),
+			Title: fmt.Sprintf("Searching for '%s'...", partName),
 			Color: accent,
 		},
 		Reference: m.Reference(),
@@ -407,7 +334,10 @@ func specsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []strin
 	}
 
 	incRequests(m.GuildID)
-	parts, err := scraper.SearchParts(args[0], "")
+	start := time.Now()
+	parts, err := scraper.SearchParts(partName, "")
+	observeScrape(requestLogger(m.Message), "search", start, err)
+	parts = limitResults(parts, args)
 
 	_, ok := err.(*gopartpicker.RedirectError)
 	if ok {
@@ -418,7 +348,7 @@ func specsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []strin
 		return
 	} else if len(parts) == 0 {
 		s.ChannelMessageEditEmbed(mes.ChannelID, mes.ID, &discordgo.MessageEmbed{
-			Title: fmt.Sprintf("Couldn't find part '%s'", args[0]),
+			Title: fmt.Sprintf("Couldn't find part '%s'", partName),
 			Color: accent,
 		})
 		return
@@ -427,6 +357,47 @@ func specsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []strin
 		return
 	}
 
+	_, editErr := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Embed: &discordgo.MessageEmbed{
+			Title: fmt.Sprintf("Search results for '%s':", partName),
+			Color: accent,
+		},
+		Components: partSelectMenu(parts, "specs"),
+		ID:         mes.ID,
+		Channel:    m.ChannelID,
+	})
+
+	if editErr != nil {
+		requestLogger(m.Message).WithError(editErr).Error("Failed to show search results")
+	}
+}
+
+// Trims search results to the number asked for with --max.
+func limitResults(parts []gopartpicker.SearchPart, args commandArgs) []gopartpicker.SearchPart {
+	if max := args.Int("max"); max > 0 && max < len(parts) {
+		return parts[:max]
+	}
+	return parts
+}
+
+// Drops search results that cost more than a price. Results in a different currency to the price are kept, as are
+// prices given without a currency, which are taken to be in the region's currency.
+func filterPartsUnder(parts []gopartpicker.SearchPart, under money, region string) []gopartpicker.SearchPart {
+	if region == "" {
+		region = "us"
+	}
+	filtered := []gopartpicker.SearchPart{}
+	for _, part := range parts {
+		price, err := parsePrice(part.Vendor.Price.TotalString, region)
+		if err != nil || (under.Currency != "" && price.Currency != under.Currency) || price.Amount <= under.Amount {
+			filtered = append(filtered, part)
+		}
+	}
+	return filtered
+}
+
+// Builds the select menu used to pick a part from search results.
+func partSelectMenu(parts []gopartpicker.SearchPart, infoType string) []discordgo.MessageComponent {
 	menuOptions := []discordgo.SelectMenuOption{}
 
 	if len(parts) > 20 {
@@ -458,27 +429,15 @@ func specsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []strin
 		},
 	}, menuOptions...)
 
-	_, editErr := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
-		Embed: &discordgo.MessageEmbed{
-			Title: fmt.Sprintf("Search results for '%s':", args[0]),
-			Color: accent,
-		},
-		Components: []discordgo.MessageComponent{
-			discordgo.ActionsRow{
-				Components: []discordgo.MessageComponent{
-					discordgo.SelectMenu{
-						CustomID: "partSelect specs",
-						Options:  menuOptions,
-					},
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID: "partSelect " + infoType,
+					Options:  menuOptions,
 				},
 			},
 		},
-		ID:      mes.ID,
-		Channel: m.ChannelID,
-	})
-
-	if editErr != nil {
-		fmt.Println(editErr)
 	}
 }
 
@@ -491,11 +450,17 @@ func partSelectHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	}
 
 	partURL := "https://" + data.Values[0]
+	infoType := strings.Split(data.CustomID, " ")[1]
+
+	if infoType == "compare" {
+		displayComparison(partURL, interactionUserID(i), s, i.Message)
+		return
+	}
 
-	displayPart(strings.Split(data.CustomID, " ")[1], partURL, s, i.Message)
+	displayPart(infoType, partURL, s, i.Message)
 }
 
-func regionsCommand(s *discordgo.Session, m *discordgo.MessageCreate, _ []string) {
+func regionsCommand(s *discordgo.Session, m *discordgo.MessageCreate, _ commandArgs) {
 	desc := ""
 
 	for _, reg := range regions {
@@ -525,9 +490,12 @@ func regionsCommand(s *discordgo.Session, m *discordgo.MessageCreate, _ []string
 }
 
 func processPCPP(s *discordgo.Session, m *discordgo.MessageCreate) {
-	g := getGuildState(m.GuildID)
-	if g.Settings&settingFlags["autopcpp"] == 0 {
-		return
+	// lists sent in DMs are always formatted, there's no guild to turn it off for
+	if m.GuildID != "" {
+		g, err := getGuildState(m.GuildID)
+		if err != nil || g.Settings&settingFlags["autopcpp"] == 0 {
+			return
+		}
 	}
 
 	urlMatches := gopartpicker.ExtractPartListURLs(m.Content)
@@ -537,15 +505,24 @@ func processPCPP(s *discordgo.Session, m *discordgo.MessageCreate) {
 	URL := urlMatches[0]
 
 	incRequests(m.GuildID)
+	start := time.Now()
 	partList, err := scraper.GetPartList(URL)
+	observeScrape(requestLogger(m.Message).WithField("list", URL), "list", start, err)
 	if err != nil {
-		log.Println(err)
 		return
 	}
 
 	desc := ""
 	image := ""
 
+	vendors := []gopartpicker.Vendor{}
+	sources := []linkSource{}
+	for _, part := range partList.Parts {
+		vendors = append(vendors, part.Vendor)
+		sources = append(sources, linkSource{GuildID: m.GuildID, PartURL: part.URL, RequestID: m.ID})
+	}
+	links := resolveVendorLinks(vendors, sources)
+
 	for i, part := range partList.Parts {
 		if part.Image != "" && image == "" {
 			image = part.Image
@@ -564,7 +541,7 @@ func processPCPP(s *discordgo.Session, m *discordgo.MessageCreate) {
 				part.Type,
 				name,
 				part.Vendor.Price.TotalString,
-				part.Vendor.URL,
+				links[i].URL,
 			)
 		}
 		toSet := desc + line
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+// How much of a panic's stack trace is sent to the error channel, to stay within Discord's embed limits.
+const maxReportedStack = 3500
+
+// Recovers from a panic in a handler, logging it with its stack and telling the user something went wrong. If an
+// error channel is configured, the report is forwarded there too. This must be deferred directly by the handler.
+func recoverHandler(s *discordgo.Session, logger *logrus.Entry, channelID string, source string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := string(debug.Stack())
+	logger.WithFields(logrus.Fields{
+		"source": source,
+		"panic":  fmt.Sprint(r),
+		"stack":  stack,
+	}).Error("Handler panicked")
+
+	requestID, _ := logger.Data["request_id"].(string)
+
+	s.ChannelMessageSendEmbed(channelID, &discordgo.MessageEmbed{
+		Title:       "Something went wrong",
+		Description: "An unexpected error occurred while handling that, it has been reported.",
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Request ID: " + requestID,
+		},
+		Color: accent,
+	})
+
+	errorChannel := conf().Bot.ErrorChannel
+	if errorChannel == "" {
+		return
+	}
+	guildID, _ := logger.Data["guild"].(string)
+	userID, _ := logger.Data["user"].(string)
+	s.ChannelMessageSendEmbed(errorChannel, &discordgo.MessageEmbed{
+		Title:       "Handler panicked",
+		Description: fmt.Sprintf("```%s```", truncate(stack, maxReportedStack)),
+		Color:       accent,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Source", Value: source, Inline: true},
+			{Name: "Request ID", Value: orNone(requestID), Inline: true},
+			{Name: "Guild", Value: orNone(guildID), Inline: true},
+			{Name: "Channel", Value: channelID, Inline: true},
+			{Name: "User", Value: orNone(userID), Inline: true},
+			{Name: "Panic", Value: truncate(fmt.Sprint(r), 1000)},
+		},
+	})
+}
+
+// Recovers from a panic in a goroutine started by a handler, which recoverHandler doesn't cover, logging it with its
+// stack. onPanic, if not nil, is called afterwards so the goroutine can leave a result behind. This must be deferred
+// directly by the goroutine.
+func recoverWorker(logger *logrus.Entry, source string, onPanic func()) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"source": source,
+		"panic":  fmt.Sprint(r),
+		"stack":  string(debug.Stack()),
+	}).Error("Goroutine panicked")
+
+	if onPanic != nil {
+		onPanic()
+	}
+}
+
+// Cuts a string down to a number of bytes without splitting a character.
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	for length > 0 && !utf8.RuneStart(value[length]) {
+		length--
+	}
+	return value[:length] + "..."
+}
+
+// Embed field values can't be empty.
+func orNone(value string) string {
+	if value == "" {
+		return "None"
+	}
+	return value
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const configPollInterval = 5 * time.Second
+
+var (
+	configFile  string
+	reloadMutex sync.Mutex
+)
+
+func init() {
+	router.addCommand(
+		command{
+			name:        "Reload",
+			description: "Reloads the config file without restarting the bot.",
+			handler:     reloadCommand,
+			category:    "Admin",
+			examples:    []string{"reload"},
+			ownerOnly:   true,
+			aliases:     []string{"reloadconfig"},
+		},
+	)
+}
+
+// Reloads the config file, swapping in the new prefix, owners, affiliates, proxies and pricing settings. Settings that need
+// a restart, such as the token, are kept as they are. Returns a list of what changed.
+func reloadConfig() ([]string, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	old := conf()
+	c, err := getConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []string{}
+
+	if c.Bot.Token != old.Bot.Token || !reflect.DeepEqual(c.Mongo, old.Mongo) || c.Tracking != old.Tracking || c.Metrics != old.Metrics || c.Health != old.Health {
+		log.Warn("Token, mongo, tracking, metrics and health settings changed but need a restart to apply")
+	}
+	c.Bot.Token = old.Bot.Token
+	c.Mongo = old.Mongo
+	c.Tracking = old.Tracking
+	c.Metrics = old.Metrics
+	c.Health = old.Health
+
+	if c.Bot.Prefix != old.Bot.Prefix {
+		changes = append(changes, fmt.Sprintf("prefix (%s -> %s)", old.Bot.Prefix, c.Bot.Prefix))
+	}
+	if !reflect.DeepEqual(c.Bot.Owners, old.Bot.Owners) {
+		changes = append(changes, "owners")
+	}
+	if c.Bot.ErrorChannel != old.Bot.ErrorChannel {
+		changes = append(changes, "error channel")
+	}
+	if !affiliatesEqual(c.PCPartPicker.Affiliates, old.PCPartPicker.Affiliates) {
+		names := []string{}
+		for _, aff := range c.PCPartPicker.Affiliates {
+			names = append(names, aff.Name)
+		}
+		changes = append(changes, fmt.Sprintf("affiliates (%s)", strings.Join(names, ", ")))
+	}
+	proxiesChanged := !reflect.DeepEqual(c.PCPartPicker.Proxies, old.PCPartPicker.Proxies)
+	if proxiesChanged {
+		changes = append(changes, fmt.Sprintf("proxies (%v -> %v)", len(old.PCPartPicker.Proxies), len(c.PCPartPicker.Proxies)))
+	}
+	if !reflect.DeepEqual(c.PCPartPicker.CompareRegions, old.PCPartPicker.CompareRegions) {
+		changes = append(changes, "compare regions")
+	}
+	if c.PCPartPicker.BaseCurrency != old.PCPartPicker.BaseCurrency || !reflect.DeepEqual(c.PCPartPicker.Rates, old.PCPartPicker.Rates) {
+		changes = append(changes, "exchange rates")
+	}
+
+	if c.Log != old.Log {
+		changes = append(changes, "logging")
+		if err := setupLogging(c.Log); err != nil {
+			return nil, err
+		}
+	}
+
+	setConf(c)
+	if proxiesChanged {
+		setProxies(c.PCPartPicker.Proxies)
+	}
+
+	if len(changes) == 0 {
+		log.Info("Reloaded config, nothing changed")
+	} else {
+		log.WithField("changes", strings.Join(changes, ", ")).Info("Reloaded config")
+	}
+
+	return changes, nil
+}
+
+// Compares the configured values of two affiliate lists, ignoring their compiled regexes.
+func affiliatesEqual(a []affiliate, b []affiliate) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Code != b[i].Code || a[i].FullRegexp != b[i].FullRegexp || a[i].ExtractIDRegexp != b[i].ExtractIDRegexp {
+			return false
+		}
+	}
+	return true
+}
+
+// Reloads the config whenever the config file is modified or the bot receives SIGHUP.
+func watchConfig() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var lastMod time.Time
+	if info, err := os.Stat(configFile); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			log.Info("Received SIGHUP, reloading config")
+		case <-ticker.C:
+			info, err := os.Stat(configFile)
+			if err != nil || !info.ModTime().After(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+			log.Info("Config file changed, reloading")
+		}
+
+		if _, err := reloadConfig(); err != nil {
+			log.WithError(err).Error("Failed to reload config, keeping the current one")
+		}
+	}
+}
+
+func reloadCommand(s *discordgo.Session, m *discordgo.MessageCreate, _ commandArgs) {
+	changes, err := reloadConfig()
+	if err != nil {
+		s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+			Embed: &discordgo.MessageEmbed{
+				Title:       "Failed to reload config",
+				Description: fmt.Sprintf("```%s```", err.Error()),
+				Color:       accent,
+			},
+			Reference: m.Reference(),
+		})
+		return
+	}
+
+	desc := "Nothing changed."
+	if len(changes) > 0 {
+		desc = "Changed: " + strings.Join(changes, ", ")
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title:       "Reloaded config",
+			Description: desc,
+			Color:       accent,
+		},
+		Reference: m.Reference(),
+	})
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"strings"
+	"sort"
 
 	"github.com/bwmarrin/discordgo"
 	"go.mongodb.org/mongo-driver/bson"
@@ -11,89 +11,160 @@ import (
 var (
 	settingFlags = map[string]int{
 		"autopcpp": 1,
-		"price":    2,
-		"specs":    4,
+		// 2 and 4 were the price and specs settings, which are now disabled commands
+		// replies to unknown commands
+		"unknowncommands": 8,
+		// replies to commands that are disabled in the guild or channel
+		"disabledreplies": 16,
 	}
-	defaultSettings = settingFlags["autopcpp"] | settingFlags["price"] | settingFlags["specs"]
+	defaultSettings = settingFlags["autopcpp"] | settingFlags["unknowncommands"]
 )
 
+var settingDescriptions = map[string]string{
+	"autopcpp":        "Turns formatting PCPartPicker list links sent in chat on or off.",
+	"disabledreplies": "Turns replies to commands that are disabled here on or off.",
+	"unknowncommands": "Turns replies to unknown commands, such as suggestions for typos, on or off.",
+}
+
 func init() {
+	subcommands := []command{}
+	for _, name := range settingNames() {
+		subcommands = append(subcommands, command{
+			name:        name,
+			description: settingDescriptions[name],
+			handler:     setSettingCommand(name),
+			args:        []string{"<state:on|off>"},
+			permissions: discordgo.PermissionManageServer,
+			examples:    []string{"settings " + name + " off"},
+		})
+	}
+	subcommands = append(subcommands, command{
+		name:        "announcements",
+		description: "Turns announcements from the bot's owners on or off. Announcements are sent to the channel this is used in.",
+		handler:     announcementsCommand,
+		args:        []string{"<state:on|off>"},
+		permissions: discordgo.PermissionManageServer,
+		examples:    []string{"settings announcements on"},
+	})
+
+	subcommands = append(subcommands, commandToggleCommand())
+
+	// announcements used to be a command of its own, so keep it working for servers that are used to it
+	router.addCommand(command{
+		name:        "announcements",
+		description: "Same as `settings announcements`.",
+		handler:     announcementsCommand,
+		args:        []string{"<state:on|off>"},
+		permissions: discordgo.PermissionManageServer,
+		category:    "Settings",
+		guildOnly:   true,
+		examples:    []string{"announcements on"},
+	})
+
 	router.addCommand(command{
 		name:        "settings",
-		description: "Toggles a setting on or off. Use without any arguments to see list of settings and their values.",
+		description: "Shows the server's settings. Use a subcommand to turn a setting on or off.",
 		handler:     settingsCommand,
-		args:        []string{"[settingName]", "[on|off]"},
+		category:    "Settings",
+		guildOnly:   true,
+		examples:    []string{"settings", "settings commands disable price", "settings announcements on"},
+		subcommands: subcommands,
 	})
 }
 
-func settingsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-	if len(args) < 2 {
-		g := getGuildState(m.GuildID)
-
-		desc := ""
-		for sett, flag := range settingFlags {
-			var state string
-			if g.Settings&flag != 0 {
-				state = "on"
-			} else {
-				state = "off"
-			}
-			desc += fmt.Sprintf("**%s:** %s\n", sett, state)
-		}
-
-		s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
-			Embed: &discordgo.MessageEmbed{
-				Title:       "PartsBot settings",
-				Description: desc,
-				Color:       accent,
-			},
-			Reference: m.Reference(),
-		})
+func settingNames() []string {
+	names := []string{}
+	for name := range settingFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
+func settingsCommand(s *discordgo.Session, m *discordgo.MessageCreate, _ commandArgs) {
+	g, err := getGuildState(m.GuildID)
+	if err != nil {
+		sendError(s, "Failed to load this server's settings.", m.ChannelID)
 		return
 	}
 
-	settingName := strings.ToLower(args[0])
-	flag, ok := settingFlags[strings.ToLower(settingName)]
-	if !ok {
-		settings := []string{}
+	desc := ""
+	for _, sett := range settingNames() {
+		var state string
+		if g.Settings&settingFlags[sett] != 0 {
+			state = "on"
+		} else {
+			state = "off"
+		}
+		desc += fmt.Sprintf("**%s:** %s\n", sett, state)
+	}
 
-		for set := range settingFlags {
-			settings = append(settings, fmt.Sprintf("`%s`", set))
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title:       "PartsBot settings",
+			Description: desc,
+			Color:       accent,
+		},
+		Reference: m.Reference(),
+	})
+}
+
+// Returns the handler of the subcommand that turns a setting on or off.
+func setSettingCommand(settingName string) func(*discordgo.Session, *discordgo.MessageCreate, commandArgs) {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+		flag := settingFlags[settingName]
+		newState := args.String("state")
+		g, err := getGuildState(m.GuildID)
+		if err != nil {
+			sendError(s, "Failed to load this server's settings.", m.ChannelID)
+			return
+		}
+
+		var newSettings int
+		switch newState {
+		case "on":
+			newSettings = g.Settings | flag
+		case "off":
+			newSettings = g.Settings &^ flag
 		}
 
+		db.Collection("guilds").UpdateOne(ctx, bson.M{
+			"id": m.GuildID,
+		}, bson.M{
+			"$set": bson.M{
+				"settings": newSettings,
+			},
+		})
+
 		s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
 			Embed: &discordgo.MessageEmbed{
-				Title:       "Invalid setting!",
-				Description: fmt.Sprintf("Available settings are:\n%s", strings.Join(settings, ", ")),
+				Description: fmt.Sprintf("Set %s to **%s**.", settingName, newState),
 				Color:       accent,
 			},
 			Reference: m.Reference(),
 		})
-		return
 	}
-	newState := strings.ToLower(args[1])
-	g := getGuildState(m.GuildID)
-
-	var newSettings int
-	switch newState {
-	case "on":
-		newSettings = g.Settings | flag
-	case "off":
-		newSettings = g.Settings &^ flag
+}
+
+func announcementsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+	channel := ""
+	desc := "Announcements turned **off**."
+	if args.String("state") == "on" {
+		channel = m.ChannelID
+		desc = fmt.Sprintf("Announcements will be sent to <#%s>.", m.ChannelID)
 	}
 
 	db.Collection("guilds").UpdateOne(ctx, bson.M{
 		"id": m.GuildID,
 	}, bson.M{
 		"$set": bson.M{
-			"settings": newSettings,
+			"announcement_channel": channel,
 		},
 	})
 
 	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
 		Embed: &discordgo.MessageEmbed{
-			Description: fmt.Sprintf("Set %s to **%s**.", settingName, newState),
+			Description: desc,
 			Color:       accent,
 		},
 		Reference: m.Reference(),
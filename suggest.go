@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Input that could be a command name, as opposed to "..." or ".5 seconds".
+var plausibleCommandRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9]{0,31}$`)
+
+// Counts the single character insertions, deletions and substitutions needed to turn one string into another.
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// Finds the command name or alias closest to an unknown name, leaving out owner-only commands for everyone else.
+// Returns an empty string if nothing is close enough to be a likely typo.
+func suggestCommand(name string, userID string) string {
+	name = strings.ToLower(name)
+	// short names need to be closer to count, otherwise everything is a typo of "help"
+	maxDistance := 1
+	if len(name) > 5 {
+		maxDistance = 2
+	}
+
+	best := ""
+	bestDistance := maxDistance + 1
+	for alias, commName := range router.aliases {
+		comm := router.commands[commName]
+		if comm.ownerOnly && !isOwner(userID) {
+			continue
+		}
+		distance := editDistance(name, alias)
+		if distance > maxDistance {
+			continue
+		}
+		// prefer the command's own name over aliases when they're equally close, then the first alphabetically, so
+		// the same typo always gets the same suggestion
+		if distance < bestDistance || (distance == bestDistance && betterSuggestion(alias, commName, best)) {
+			best = alias
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
+
+// Breaks a tie between an alias and the best suggestion so far.
+func betterSuggestion(alias string, commName string, best string) bool {
+	if best == "" {
+		return true
+	}
+	bestIsName := router.aliases[best] == best
+	if (alias == commName) != bestIsName {
+		return alias == commName
+	}
+	return alias < best
+}
+
+// Replies to an unknown command with the closest match. Nothing is sent for input that doesn't look like a command
+// or when the guild has turned unknown command replies off. Returns whether the message was treated as a command.
+func handleUnknownCommand(s *discordgo.Session, m *discordgo.MessageCreate, name string, pinged bool) bool {
+	if !plausibleCommandRegexp.MatchString(name) {
+		return false
+	}
+
+	suggestion := suggestCommand(name, m.Author.ID)
+	// a bare unknown name after the prefix is often just chat, so only reply without a suggestion when pinged
+	if suggestion == "" && !pinged {
+		return true
+	}
+
+	if m.GuildID != "" {
+		g, err := getGuildState(m.GuildID)
+		if err != nil || g.Settings&settingFlags["unknowncommands"] == 0 {
+			return true
+		}
+	}
+
+	desc := fmt.Sprintf("Use `%shelp` to see all commands.", conf().Bot.Prefix)
+	if suggestion != "" {
+		desc = fmt.Sprintf("Did you mean `%s%s`?", conf().Bot.Prefix, suggestion)
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("Couldn't find command '%s'.", name),
+			Description: desc,
+			Color:       accent,
+		},
+		Reference: m.Reference(),
+	})
+	return true
+}
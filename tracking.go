@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A tracked affiliate link that redirects through the bot's redirect service.
+type trackedLink struct {
+	ID        string `bson:"id"`
+	URL       string `bson:"url"`
+	Affiliate string `bson:"affiliate"`
+	Vendor    string `bson:"vendor"`
+	GuildID   string `bson:"guild"`
+	PartURL   string `bson:"part"`
+}
+
+type click struct {
+	Link      string    `bson:"link"`
+	Affiliate string    `bson:"affiliate"`
+	Vendor    string    `bson:"vendor"`
+	GuildID   string    `bson:"guild"`
+	PartURL   string    `bson:"part"`
+	Time      time.Time `bson:"time"`
+}
+
+func init() {
+	router.addCommand(
+		command{
+			name:        "AffStats",
+			description: "Shows affiliate link clicks over time.",
+			handler:     affStatsCommand,
+			category:    "Admin",
+			examples:    []string{"affstats"},
+			ownerOnly:   true,
+			aliases:     []string{"affiliatestats", "clicks"},
+		},
+	)
+}
+
+// Wraps an affiliate URL in a link to the redirect service so clicks on it are recorded. URLs are returned as they
+// are if tracking is disabled.
+func trackedURL(URL string, affiliateName string, vendorName string, src linkSource) string {
+	if !conf().Tracking.Enabled {
+		return URL
+	}
+
+	// the same link shown in the same guild for the same part always gets the same ID
+	hash := sha1.Sum([]byte(strings.Join([]string{URL, src.GuildID, src.PartURL}, "|")))
+	id := hex.EncodeToString(hash[:])[:12]
+
+	_, err := db.Collection("links").UpdateOne(ctx, bson.M{
+		"id": id,
+	}, bson.M{
+		"$setOnInsert": trackedLink{
+			ID:        id,
+			URL:       URL,
+			Affiliate: affiliateName,
+			Vendor:    vendorName,
+			GuildID:   src.GuildID,
+			PartURL:   src.PartURL,
+		},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		src.logger().WithError(err).Error("Failed to store tracked link")
+		return URL
+	}
+
+	return fmt.Sprintf("%s/r/%s", strings.TrimSuffix(conf().Tracking.PublicURL, "/"), id)
+}
+
+// Starts the redirect service that records clicks on tracked links.
+func startTrackingServer() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/r/", redirectHandler)
+
+	// the service is public, so slow or idle clients mustn't be able to hold connections open
+	server := &http.Server{
+		Addr:              conf().Tracking.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	log.WithField("address", conf().Tracking.Address).Info("Starting redirect service")
+	if err := server.ListenAndServe(); err != nil {
+		log.WithError(err).Error("Redirect service stopped")
+	}
+}
+
+func redirectHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/r/")
+
+	var link trackedLink
+	err := db.Collection("links").FindOne(ctx, bson.M{
+		"id": id,
+	}).Decode(&link)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	_, err = db.Collection("clicks").InsertOne(ctx, click{
+		Link:      link.ID,
+		Affiliate: link.Affiliate,
+		Vendor:    link.Vendor,
+		GuildID:   link.GuildID,
+		PartURL:   link.PartURL,
+		Time:      time.Now(),
+	})
+	if err != nil {
+		log.WithError(err).WithField("link", id).Error("Failed to record click")
+	}
+
+	http.Redirect(w, r, link.URL, http.StatusFound)
+}
+
+// Counts clicks since a point in time, grouped by a field of the click.
+func countClicks(since time.Time, field string) map[string]int {
+	counts := map[string]int{}
+
+	cur, err := db.Collection("clicks").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"time": bson.M{"$gte": since}}},
+		{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to count clicks")
+		return counts
+	}
+
+	var results []struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	cur.All(ctx, &results)
+
+	for _, res := range results {
+		counts[res.ID] = res.Count
+	}
+	return counts
+}
+
+func affStatsCommand(s *discordgo.Session, m *discordgo.MessageCreate, _ commandArgs) {
+	now := time.Now()
+	periods := []struct {
+		name  string
+		since time.Time
+	}{
+		{"24 hours", now.AddDate(0, 0, -1)},
+		{"7 days", now.AddDate(0, 0, -7)},
+		{"30 days", now.AddDate(0, 0, -30)},
+		{"All time", time.Time{}},
+	}
+
+	fields := []*discordgo.MessageEmbedField{}
+
+	for _, period := range periods {
+		counts := countClicks(period.since, "affiliate")
+		value := ""
+		for _, aff := range conf().PCPartPicker.Affiliates {
+			value += fmt.Sprintf("**%s:** %v\n", aff.Name, counts[aff.Name])
+		}
+		if value == "" {
+			value = "No affiliates configured."
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   period.name,
+			Value:  value,
+			Inline: true,
+		})
+	}
+
+	vendorCounts := countClicks(periods[2].since, "vendor")
+	vendors := []string{}
+	for vendor := range vendorCounts {
+		vendors = append(vendors, vendor)
+	}
+	sort.Slice(vendors, func(i, j int) bool {
+		return vendorCounts[vendors[i]] > vendorCounts[vendors[j]]
+	})
+	if len(vendors) > 5 {
+		vendors = vendors[:5]
+	}
+	if len(vendors) > 0 {
+		lines := []string{}
+		for _, vendor := range vendors {
+			lines = append(lines, fmt.Sprintf("**%s:** %v", vendor, vendorCounts[vendor]))
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Top vendors (30 days)",
+			Value: strings.Join(lines, "\n"),
+		})
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:  "Affiliate clicks",
+		Color:  accent,
+		Fields: fields,
+	}
+	if !conf().Tracking.Enabled {
+		embed.Description = "Click tracking is currently disabled."
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed:     embed,
+		Reference: m.Reference(),
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A user's own settings, which apply in servers and DMs alike.
+type userSettings struct {
+	ID string `bson:"id"`
+	// region searched by the price command when none is given, empty for the US
+	Region string `bson:"region"`
+	// currency price comparisons are converted into, empty for the configured base currency
+	Currency string `bson:"currency"`
+}
+
+func init() {
+	router.addCommand(command{
+		name:        "Preferences",
+		description: "Shows your own settings, which apply everywhere including DMs. Use a subcommand to change one.",
+		handler:     preferencesCommand,
+		aliases:     []string{"prefs"},
+		category:    "Settings",
+		examples:    []string{"preferences", "preferences region uk", "preferences currency gbp"},
+		subcommands: []command{
+			{
+				name:        "region",
+				description: "Sets the region the price command searches when no region is given. Leave it out to go back to the US.",
+				handler:     setRegionPreference,
+				args:        []string{"[region:region]"},
+				examples:    []string{"preferences region uk", "preferences region"},
+			},
+			{
+				name:        "currency",
+				description: "Sets the currency price comparisons are converted into. Leave it out to go back to the default.",
+				handler:     setCurrencyPreference,
+				args:        []string{"[currency]"},
+				examples:    []string{"preferences currency gbp", "preferences currency"},
+			},
+		},
+	})
+}
+
+// Gets a user's settings. Users who haven't changed any get the zero value.
+func getUserSettings(ID string) (userSettings, error) {
+	var u userSettings
+	err := db.Collection("users").FindOne(ctx, bson.M{
+		"id": ID,
+	}).Decode(&u)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return userSettings{}, nil
+	} else if err != nil {
+		log.WithError(err).WithField("user", ID).Error("Failed to load user")
+		return userSettings{}, err
+	}
+	return u, nil
+}
+
+func setUserSetting(ID string, key string, value string) error {
+	update := func() error {
+		_, err := db.Collection("users").UpdateOne(ctx, bson.M{
+			"id": ID,
+		}, bson.M{
+			"$set": bson.M{
+				key: value,
+			},
+		}, options.Update().SetUpsert(true))
+		return err
+	}
+
+	err := update()
+	// two first writes for a user can race to insert, the loser can update the document the winner inserted
+	if mongo.IsDuplicateKeyError(err) {
+		err = update()
+	}
+	return err
+}
+
+// Returns the ID of the user who triggered an interaction, which is in a different place for DMs.
+func interactionUserID(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	} else if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+// Returns the currencies there are exchange rates for.
+func knownCurrencies() []string {
+	currencies := []string{baseCurrency()}
+	for currency := range conf().PCPartPicker.Rates {
+		if currency != baseCurrency() {
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Strings(currencies[1:])
+	return currencies
+}
+
+// Returns the currency to show a user's price comparisons in, falling back to the base currency if theirs is no
+// longer configured.
+func userCurrency(userID string) string {
+	u, err := getUserSettings(userID)
+	if err != nil || u.Currency == "" {
+		return baseCurrency()
+	}
+	for _, currency := range knownCurrencies() {
+		if currency == u.Currency {
+			return currency
+		}
+	}
+	return baseCurrency()
+}
+
+func preferencesCommand(s *discordgo.Session, m *discordgo.MessageCreate, _ commandArgs) {
+	u, err := getUserSettings(m.Author.ID)
+	if err != nil {
+		sendError(s, "Failed to load your settings.", m.ChannelID)
+		return
+	}
+
+	region := "us (default)"
+	if u.Region != "" {
+		region = u.Region
+	}
+	currency := fmt.Sprintf("%s (default)", baseCurrency())
+	if u.Currency != "" {
+		currency = u.Currency
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title:       "Your settings",
+			Description: fmt.Sprintf("**region:** %s\n**currency:** %s", region, currency),
+			Color:       accent,
+		},
+		Reference: m.Reference(),
+	})
+}
+
+func setRegionPreference(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+	region := args.String("region")
+	if err := setUserSetting(m.Author.ID, "region", region); err != nil {
+		requestLogger(m.Message).WithError(err).Error("Failed to update user")
+		sendError(s, "Failed to update your settings.", m.ChannelID)
+		return
+	}
+
+	desc := fmt.Sprintf("Your region is now **%s**.", region)
+	if region == "" {
+		desc = "Your region is back to **us**."
+	}
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Description: desc,
+			Color:       accent,
+		},
+		Reference: m.Reference(),
+	})
+}
+
+func setCurrencyPreference(s *discordgo.Session, m *discordgo.MessageCreate, args commandArgs) {
+	currency := strings.ToUpper(args.String("currency"))
+	if currency != "" {
+		known := knownCurrencies()
+		found := false
+		for _, c := range known {
+			found = found || c == currency
+		}
+		if !found {
+			sendError(s, fmt.Sprintf("There's no exchange rate for %s. The available currencies are %s.", currency, strings.Join(known, ", ")), m.ChannelID)
+			return
+		}
+	}
+
+	if err := setUserSetting(m.Author.ID, "currency", currency); err != nil {
+		requestLogger(m.Message).WithError(err).Error("Failed to update user")
+		sendError(s, "Failed to update your settings.", m.ChannelID)
+		return
+	}
+
+	desc := fmt.Sprintf("Your currency is now **%s**.", currency)
+	if currency == "" {
+		desc = fmt.Sprintf("Your currency is back to **%s**.", baseCurrency())
+	}
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Description: desc,
+			Color:       accent,
+		},
+		Reference: m.Reference(),
+	})
+}